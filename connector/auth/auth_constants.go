@@ -19,10 +19,12 @@
 
 package auth
 
+import "strings"
+
 var (
 	// ToChannelFromBotLoginURL : Login URL
 	//
-	//DEPRECATED: DO NOT USE
+	//DEPRECATED: Use ToChannelFromBotTokenURL
 	ToChannelFromBotLoginURL = []string{
 		"https://login.microsoftonline.com/botframework.com/oauth2/v2.0/token",
 	}
@@ -32,7 +34,8 @@ var (
 		"https://login.botframework.com/v1/.well-known/openidconfiguration",
 	}
 
-	// ToBotFromEnterpriseChannelOpenIDMetadataURLFormat : OpenID metadata document for tokens coming from MSA
+	// ToBotFromEnterpriseChannelOpenIDMetadataURLFormat : OpenID metadata document for tokens coming from an
+	// enterprise channel, {channelService} being its name. See EnterpriseChannelEnvironment.
 	ToBotFromEnterpriseChannelOpenIDMetadataURLFormat = []string{
 		"https://{channelService}.enterprisechannel.botframework.com",
 		"/v1/.well-known/openidconfiguration",
@@ -43,6 +46,20 @@ var (
 		"https://login.microsoftonline.com/common/v2.0/.well-known/openid-configuration",
 	}
 
+	// ToBotFromEmulatorTokenIssuers : Issuers of tokens coming from the emulator, with v1 and v2 tokens
+	ToBotFromEmulatorTokenIssuers = []string{
+		"https://sts.windows.net/d6d49420-f39b-4df7-a1dc-d59a935871db/",
+		"https://login.microsoftonline.com/d6d49420-f39b-4df7-a1dc-d59a935871db/v2.0",
+		"https://sts.windows.net/f8cdef31-a31e-4b4a-93e4-5f571e91255a/",
+		"https://login.microsoftonline.com/f8cdef31-a31e-4b4a-93e4-5f571e91255a/v2.0",
+	}
+
+	// ToBotFromEmulatorTokenIssuersGov : Issuers of tokens coming from the emulator in the US Government cloud
+	ToBotFromEmulatorTokenIssuersGov = []string{
+		"https://sts.windows.net/cab8a31a-1906-4287-a0d8-4eef66b95f6e/",
+		"https://login.microsoftonline.us/cab8a31a-1906-4287-a0d8-4eef66b95f6e/v2.0",
+	}
+
 	// AllowedSigningAlgorithms : Tokens come from channels to the bot. The code
 	//that uses this also supports tokens coming from the emulator.
 	AllowedSigningAlgorithms = []string{"RS256", "RS384", "RS512"}
@@ -52,8 +69,13 @@ const (
 	// ToChannelFromBotLoginURLPrefix : Login URL prefix
 	ToChannelFromBotLoginURLPrefix = "https://login.microsoftonline.com/"
 
+	// ToChannelFromBotTokenEndpointPath : Login URL token endpoint path
+	ToChannelFromBotTokenEndpointPath = "/oauth2/v2.0/token"
+
 	// ToChannelFromBotTokenEndpointPathTOCHANNELFROMBOTTOKENENDPOINTPATH : Login URL token endpoint path
-	ToChannelFromBotTokenEndpointPathTOCHANNELFROMBOTTOKENENDPOINTPATH = "/oauth2/v2.0/token"
+	//
+	//DEPRECATED: Use ToChannelFromBotTokenEndpointPath
+	ToChannelFromBotTokenEndpointPathTOCHANNELFROMBOTTOKENENDPOINTPATH = ToChannelFromBotTokenEndpointPath
 
 	// DefaultChannelAuthTenant : Default tenant from which to obtain a token for bot to channel communication
 	DefaultChannelAuthTenant = "botframework.com"
@@ -64,6 +86,27 @@ const (
 	// ToBotFromChannelTokenIssuer : Token issuer
 	ToBotFromChannelTokenIssuer = "https://api.botframework.com"
 
+	// GovernmentChannelService : ChannelService value of the US Government cloud.
+	GovernmentChannelService = "https://botframework.azure.us"
+
+	// ToChannelFromBotLoginURLPrefixGov : Login URL prefix of the US Government cloud
+	ToChannelFromBotLoginURLPrefixGov = "https://login.microsoftonline.us/"
+
+	// DefaultChannelAuthTenantGov : Tenant from which to obtain a token for bot to channel communication in the US Government cloud
+	DefaultChannelAuthTenantGov = "MicrosoftServices.onmicrosoft.com"
+
+	// ToChannelFromBotOauthScopeGov : OAuth scope to request in the US Government cloud
+	ToChannelFromBotOauthScopeGov = "https://api.botframework.us/.default"
+
+	// ToBotFromChannelTokenIssuerGov : Token issuer in the US Government cloud
+	ToBotFromChannelTokenIssuerGov = "https://api.botframework.us"
+
+	// ToBotFromChannelOpenIDMetadataURLGov : OpenID metadata document for tokens coming from channels in the US Government cloud
+	ToBotFromChannelOpenIDMetadataURLGov = "https://login.botframework.azure.us/v1/.well-known/openidconfiguration"
+
+	// ToBotFromEmulatorOpenIDMetadataURLGov : OpenID metadata document for tokens coming from the emulator in the US Government cloud
+	ToBotFromEmulatorOpenIDMetadataURLGov = "https://login.microsoftonline.us/cab8a31a-1906-4287-a0d8-4eef66b95f6e/v2.0/.well-known/openid-configuration"
+
 	// BotOpenIDMetadataKey : Application Setting Key for the OpenIdMetadataURL value.
 	BotOpenIDMetadataKey = "BotOpenIdMetadata"
 
@@ -119,6 +162,10 @@ const (
 	*/
 	KeyIDHeader = "kid"
 
+	// EndorsementsKey JWK parameter listing the channels for which the key may sign tokens.
+	// As used in Microsoft Bot Framework signing keys.
+	EndorsementsKey = "endorsements"
+
 	// VersionClaim Token version claim name. As used in Microsoft AAD tokens.
 	VersionClaim = "ver"
 
@@ -128,3 +175,9 @@ const (
 	// ServiceURLClaim Service URL claim name. As used in Microsoft Bot Framework v3.1 auth.
 	ServiceURLClaim = "serviceurl"
 )
+
+// ToChannelFromBotTokenURL returns the URL of the token endpoint of the tenant at the login endpoint,
+// e.g. https://login.microsoftonline.com/botframework.com/oauth2/v2.0/token.
+func ToChannelFromBotTokenURL(loginEndpoint string, tenant string) string {
+	return strings.TrimSuffix(loginEndpoint, "/") + "/" + tenant + ToChannelFromBotTokenEndpointPath
+}
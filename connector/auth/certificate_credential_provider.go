@@ -0,0 +1,351 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ClientAssertionType is the type of the client assertion JWTs used to authenticate with a certificate.
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionLifetime is how long a client assertion is valid.
+const clientAssertionLifetime = 10 * time.Minute
+
+// ClientAssertionProvider is implemented by credentials authenticating with a signed client assertion
+// instead of a password, like CertificateCredentialProvider.
+type ClientAssertionProvider interface {
+	// ClientAssertion returns a client assertion JWT for the token endpoint with the given URL.
+	ClientAssertion(tokenURL string) (string, error)
+}
+
+// CertificateCredentialProvider can be used for authentication to the connector service using
+// AppID and an X.509 certificate registered for the app, signing client assertions with the private
+// key of the certificate.
+//
+// The certificate can be replaced while in use with UpdateCertificate. A provider created with
+// NewCertificateCredentialProviderFromFile reloads the file whenever it is modified, and keeps using the
+// last certificate loaded while the file cannot be loaded, see ReloadError.
+type CertificateCredentialProvider struct {
+	AppID string
+
+	mu          sync.RWMutex
+	certificate *x509.Certificate
+	key         crypto.Signer
+
+	// path and password of the certificate file, if any, its modification time when loaded
+	// and the error of the last attempt to load it again
+	path      string
+	password  string
+	modTime   time.Time
+	reloadErr error
+}
+
+// NewCertificateCredentialProvider returns a CertificateCredentialProvider using the certificate and its
+// RSA private key.
+func NewCertificateCredentialProvider(appID string, certificate *x509.Certificate, key crypto.PrivateKey) (*CertificateCredentialProvider, error) {
+	cp := &CertificateCredentialProvider{AppID: appID}
+	if err := cp.UpdateCertificate(certificate, key); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// NewCertificateCredentialProviderFromPEM returns a CertificateCredentialProvider using the certificate and
+// private key in the PEM data. The private key may be in PKCS #1 or PKCS #8 form.
+func NewCertificateCredentialProviderFromPEM(appID string, pemData []byte) (*CertificateCredentialProvider, error) {
+	certificate, key, err := parsePEMCertificate(pemData)
+	if err != nil {
+		return nil, err
+	}
+	return NewCertificateCredentialProvider(appID, certificate, key)
+}
+
+// NewCertificateCredentialProviderFromPKCS12 returns a CertificateCredentialProvider using the certificate and
+// private key in the PKCS #12 (PFX) data, protected by password.
+func NewCertificateCredentialProviderFromPKCS12(appID string, pfxData []byte, password string) (*CertificateCredentialProvider, error) {
+	certificate, key, err := parsePKCS12Certificate(pfxData, password)
+	if err != nil {
+		return nil, err
+	}
+	return NewCertificateCredentialProvider(appID, certificate, key)
+}
+
+// NewCertificateCredentialProviderFromFile returns a CertificateCredentialProvider using the certificate and
+// private key in the PEM or PKCS #12 file at path. The password is only used for PKCS #12 files.
+//
+// The file is loaded again when it is modified, so that the certificate can be rotated by replacing the file.
+func NewCertificateCredentialProviderFromFile(appID string, path string, password string) (*CertificateCredentialProvider, error) {
+	cp := &CertificateCredentialProvider{AppID: appID, path: path, password: password}
+	if err := cp.reload(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// IsValidAppID returns if the specified appID is valid.
+func (cp *CertificateCredentialProvider) IsValidAppID(appID string) bool {
+	return cp.AppID == appID
+}
+
+// GetAppPassword returns an empty password, as the credential has none.
+func (cp *CertificateCredentialProvider) GetAppPassword() string {
+	return ""
+}
+
+// GetAppID returns the AppID of the credential.
+func (cp *CertificateCredentialProvider) GetAppID() string {
+	return cp.AppID
+}
+
+// IsAuthenticationDisabled checks if no authentication is to be performed.
+func (cp *CertificateCredentialProvider) IsAuthenticationDisabled() bool {
+	return cp.AppID == ""
+}
+
+// Certificate returns the certificate currently in use.
+func (cp *CertificateCredentialProvider) Certificate() *x509.Certificate {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.certificate
+}
+
+// ReloadError returns why the modified certificate file could not be loaded, or nil if it was loaded.
+// The previous certificate is used until the file is loaded, which is attempted again with every client assertion.
+func (cp *CertificateCredentialProvider) ReloadError() error {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.reloadErr
+}
+
+// UpdateCertificate replaces the certificate and private key used for the following client assertions.
+func (cp *CertificateCredentialProvider) UpdateCertificate(certificate *x509.Certificate, key crypto.PrivateKey) error {
+	if certificate == nil {
+		return errors.New("Missing certificate")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return errors.New("Unsupported private key type")
+	}
+	if !matches(signer, certificate) {
+		return errors.New("Private key does not match the certificate")
+	}
+	if _, err := signingMethod(signer); err != nil {
+		return err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.certificate = certificate
+	cp.key = signer
+	return nil
+}
+
+// ClientAssertion implements ClientAssertionProvider.
+//
+// The assertion is signed with the private key and identifies the certificate by its SHA-1 thumbprint
+// in the x5t header, as expected by the Microsoft identity platform.
+func (cp *CertificateCredentialProvider) ClientAssertion(tokenURL string) (string, error) {
+	if cp.path != "" {
+		err := cp.reloadIfModified()
+		cp.mu.Lock()
+		cp.reloadErr = err
+		cp.mu.Unlock()
+	}
+
+	cp.mu.RLock()
+	certificate, key := cp.certificate, cp.key
+	cp.mu.RUnlock()
+
+	method, err := signingMethod(key)
+	if err != nil {
+		return "", err
+	}
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(method, jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{tokenURL},
+		Issuer:    cp.AppID,
+		Subject:   cp.AppID,
+		ID:        hex.EncodeToString(jti),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(clientAssertionLifetime)),
+	})
+	thumbprint := sha1.Sum(certificate.Raw)
+	token.Header["x5t"] = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+
+	assertion, err := token.SignedString(key)
+	return assertion, errors.Wrap(err, "Failed to sign client assertion.")
+}
+
+// reloadIfModified loads the certificate file again if it was modified since it was last loaded.
+func (cp *CertificateCredentialProvider) reloadIfModified() error {
+	info, err := os.Stat(cp.path)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read certificate file %s.", cp.path)
+	}
+
+	cp.mu.RLock()
+	modified := !info.ModTime().Equal(cp.modTime)
+	cp.mu.RUnlock()
+	if !modified {
+		return nil
+	}
+	return cp.reload()
+}
+
+// reload loads the certificate file.
+func (cp *CertificateCredentialProvider) reload() error {
+	info, err := os.Stat(cp.path)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read certificate file %s.", cp.path)
+	}
+	data, err := ioutil.ReadFile(cp.path)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read certificate file %s.", cp.path)
+	}
+
+	var certificate *x509.Certificate
+	var key crypto.PrivateKey
+	if strings.Contains(string(data), "-----BEGIN") {
+		certificate, key, err = parsePEMCertificate(data)
+	} else {
+		certificate, key, err = parsePKCS12Certificate(data, cp.password)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to load certificate file %s.", cp.path)
+	}
+	if err := cp.UpdateCertificate(certificate, key); err != nil {
+		return err
+	}
+
+	cp.mu.Lock()
+	cp.modTime = info.ModTime()
+	cp.mu.Unlock()
+	return nil
+}
+
+// signingMethod returns the signing method for the key. The Microsoft identity platform only accepts
+// client assertions signed with RSA keys.
+func signingMethod(key crypto.Signer) (jwt.SigningMethod, error) {
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		return jwt.SigningMethodRS256, nil
+	}
+	return nil, errors.New("Unsupported private key type, expecting an RSA key")
+}
+
+// matches checks if the key is the private key of the certificate.
+func matches(key crypto.Signer, certificate *x509.Certificate) bool {
+	public, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && public.Equal(certificate.PublicKey)
+}
+
+// parsePKCS12Certificate returns the private key in the PKCS #12 data and the certificate for it,
+// which may be stored with its chain. Both legacy (RC2, 3DES) and modern (AES) encryption are supported.
+func parsePKCS12Certificate(pfxData []byte, password string) (*x509.Certificate, crypto.PrivateKey, error) {
+	privateKey, certificate, chain, err := pkcs12.DecodeChain(pfxData, password)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to decode PKCS #12 data.")
+	}
+	key, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("Unsupported private key type")
+	}
+	return certificateFor(key, append([]*x509.Certificate{certificate}, chain...))
+}
+
+// parsePEMCertificate returns the private key in the PEM data and the certificate for it, which may be
+// followed or preceded by its chain.
+func parsePEMCertificate(pemData []byte) (*x509.Certificate, crypto.PrivateKey, error) {
+	var certificates []*x509.Certificate
+	var key crypto.Signer
+	for {
+		var block *pem.Block
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "Failed to parse certificate.")
+			}
+			certificates = append(certificates, certificate)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			parsed, err := parsePrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			key = parsed
+		}
+	}
+
+	if key == nil {
+		return nil, nil, errors.New("No private key found")
+	}
+	return certificateFor(key, certificates)
+}
+
+// certificateFor returns the certificate of the key among the certificates.
+func certificateFor(key crypto.Signer, certificates []*x509.Certificate) (*x509.Certificate, crypto.PrivateKey, error) {
+	for _, certificate := range certificates {
+		if matches(key, certificate) {
+			return certificate, key, nil
+		}
+	}
+	return nil, nil, errors.New("No certificate found for the private key")
+}
+
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse private key.")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("Unsupported private key type")
+	}
+	return signer, nil
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/infracloudio/msbotbuilder-go/connector/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const tokenURL = "https://login.microsoftonline.com/botframework.com/oauth2/v2.0/token"
+
+// newCertificatePEM returns a self-signed certificate and its private key in PEM form.
+func newCertificatePEM(t *testing.T) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "msbotbuilder-go test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return append(pemData, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})...)
+}
+
+// verifyAssertion checks the client assertion of the provider is signed by its certificate.
+func verifyAssertion(t *testing.T, cp *auth.CertificateCredentialProvider) {
+	assertion, err := cp.ClientAssertion(tokenURL)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	certificate := cp.Certificate()
+	claims := jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(assertion, &claims, func(token *jwt.Token) (interface{}, error) {
+		return certificate.PublicKey, nil
+	})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, "RS256", token.Header["alg"], "Expect RS256 signature")
+	thumbprint := sha1.Sum(certificate.Raw)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(thumbprint[:]), token.Header["x5t"], "Expect certificate thumbprint")
+	assert.True(t, claims.VerifyAudience(tokenURL, true), "Expect token URL audience")
+	assert.Equal(t, "app-id", claims.Issuer, "Expect app ID issuer")
+	assert.Equal(t, "app-id", claims.Subject, "Expect app ID subject")
+	assert.NotEmpty(t, claims.ID, "Expect assertion ID")
+}
+
+func TestCertificateCredentialProvider(t *testing.T) {
+	t.Run("PEM", func(t *testing.T) {
+		cp, err := auth.NewCertificateCredentialProviderFromPEM("app-id", newCertificatePEM(t))
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		assert.Equal(t, "app-id", cp.GetAppID(), "Expect app ID")
+		assert.Empty(t, cp.GetAppPassword(), "Expect no password")
+		verifyAssertion(t, cp)
+	})
+
+	t.Run("PKCS12", func(t *testing.T) {
+		pfxData, err := ioutil.ReadFile("testdata/certificate.p12")
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		cp, err := auth.NewCertificateCredentialProviderFromPKCS12("app-id", pfxData, "secret")
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		verifyAssertion(t, cp)
+
+		_, err = auth.NewCertificateCredentialProviderFromPKCS12("app-id", pfxData, "wrong")
+		assert.NotNil(t, err, "Expect error for wrong password")
+	})
+
+	t.Run("PKCS12 with AES encryption", func(t *testing.T) {
+		// Exported by OpenSSL 3 with its defaults: AES-256-CBC, PBKDF2 and a SHA-256 MAC
+		pfxData, err := ioutil.ReadFile("testdata/certificate-aes.p12")
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		cp, err := auth.NewCertificateCredentialProviderFromPKCS12("app-id", pfxData, "secret")
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		verifyAssertion(t, cp)
+
+		_, err = auth.NewCertificateCredentialProviderFromPKCS12("app-id", pfxData, "wrong")
+		assert.NotNil(t, err, "Expect error for wrong password")
+	})
+
+	t.Run("mismatched key", func(t *testing.T) {
+		first, err := auth.NewCertificateCredentialProviderFromPEM("app-id", newCertificatePEM(t))
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		err = first.UpdateCertificate(first.Certificate(), key)
+		assert.NotNil(t, err, "Expect error for key not matching the certificate")
+	})
+
+	t.Run("file rotation", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "certificate.pem")
+		assert.Nil(t, ioutil.WriteFile(path, newCertificatePEM(t), 0600))
+		cp, err := auth.NewCertificateCredentialProviderFromFile("app-id", path, "")
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		first := cp.Certificate()
+		verifyAssertion(t, cp)
+
+		assert.Nil(t, ioutil.WriteFile(path, newCertificatePEM(t), 0600))
+		modTime := time.Now().Add(time.Minute)
+		assert.Nil(t, os.Chtimes(path, modTime, modTime))
+		verifyAssertion(t, cp)
+		assert.NotEqual(t, first.Raw, cp.Certificate().Raw, "Expect rotated certificate")
+	})
+
+	t.Run("failed rotation", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "certificate.pem")
+		certificatePEM := newCertificatePEM(t)
+		assert.Nil(t, ioutil.WriteFile(path, certificatePEM, 0600))
+		cp, err := auth.NewCertificateCredentialProviderFromFile("app-id", path, "")
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		first := cp.Certificate()
+
+		// Half-written file
+		assert.Nil(t, ioutil.WriteFile(path, certificatePEM[:len(certificatePEM)/2], 0600))
+		modTime := time.Now().Add(time.Minute)
+		assert.Nil(t, os.Chtimes(path, modTime, modTime))
+		verifyAssertion(t, cp)
+		assert.Equal(t, first.Raw, cp.Certificate().Raw, "Expect previous certificate to be kept")
+		assert.NotNil(t, cp.ReloadError(), "Expect reload error to be reported")
+
+		assert.Nil(t, ioutil.WriteFile(path, newCertificatePEM(t), 0600))
+		assert.Nil(t, os.Chtimes(path, modTime, modTime))
+		verifyAssertion(t, cp)
+		assert.NotEqual(t, first.Raw, cp.Certificate().Raw, "Expect rotated certificate")
+		assert.Nil(t, cp.ReloadError(), "Expect reload error to be cleared")
+	})
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package auth
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChannelEnvironment holds the endpoints of a cloud hosting the Bot Framework channels.
+type ChannelEnvironment struct {
+	Name string
+
+	// LoginEndpoint is the login URL prefix from which tokens for the connector service are requested.
+	LoginEndpoint string
+	// ChannelAuthTenant is the tenant from which tokens for the connector service are requested.
+	ChannelAuthTenant string
+	// OAuthScope is the scope of tokens for the connector service.
+	OAuthScope string
+
+	// OpenIDMetadataURL is the OpenID metadata document referencing the keys signing tokens from channels.
+	OpenIDMetadataURL string
+	// TokenIssuers are the valid issuers of tokens from channels.
+	TokenIssuers []string
+
+	// EmulatorOpenIDMetadataURL is the OpenID metadata document referencing the keys signing tokens from
+	// the Bot Framework Emulator. Tokens from the emulator are rejected if empty.
+	EmulatorOpenIDMetadataURL string
+	// EmulatorTokenIssuers are the valid issuers of tokens from the emulator.
+	EmulatorTokenIssuers []string
+}
+
+var (
+	// PublicCloud is the ChannelEnvironment of the public Azure cloud.
+	PublicCloud = ChannelEnvironment{
+		Name:              "Public",
+		LoginEndpoint:     ToChannelFromBotLoginURLPrefix,
+		ChannelAuthTenant: DefaultChannelAuthTenant,
+		OAuthScope:        ToChannelFromBotOauthScope,
+		OpenIDMetadataURL: ToBotFromChannelOpenIDMetadataURL[0],
+		TokenIssuers:      []string{ToBotFromChannelTokenIssuer},
+
+		EmulatorOpenIDMetadataURL: ToBotFromEmulatorOpenIDMetadataURL[0],
+		EmulatorTokenIssuers:      ToBotFromEmulatorTokenIssuers,
+	}
+
+	// USGovernmentCloud is the ChannelEnvironment of the Azure US Government cloud.
+	USGovernmentCloud = ChannelEnvironment{
+		Name:              "USGovernment",
+		LoginEndpoint:     ToChannelFromBotLoginURLPrefixGov,
+		ChannelAuthTenant: DefaultChannelAuthTenantGov,
+		OAuthScope:        ToChannelFromBotOauthScopeGov,
+		OpenIDMetadataURL: ToBotFromChannelOpenIDMetadataURLGov,
+		TokenIssuers:      []string{ToBotFromChannelTokenIssuerGov},
+
+		EmulatorOpenIDMetadataURL: ToBotFromEmulatorOpenIDMetadataURLGov,
+		EmulatorTokenIssuers:      ToBotFromEmulatorTokenIssuersGov,
+	}
+)
+
+// enterpriseChannelServiceMatch validates the name of an enterprise channel service, which becomes part of a host name.
+var enterpriseChannelServiceMatch = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]*$`)
+
+// ChannelEnvironmentForService returns the ChannelEnvironment selected by the ChannelService setting:
+// PublicCloud if empty, USGovernmentCloud for GovernmentChannelService, or the EnterpriseChannelEnvironment
+// of the enterprise channel service if it is a name rather than a URL.
+//
+// The setting key ChannelService, used as the value by earlier configurations, selects PublicCloud.
+//
+// Custom clouds are configured with their ChannelEnvironment instead.
+func ChannelEnvironmentForService(channelService string) (ChannelEnvironment, error) {
+	switch {
+	case channelService == "", channelService == ChannelService:
+		return PublicCloud, nil
+	case channelService == GovernmentChannelService:
+		return USGovernmentCloud, nil
+	case !strings.Contains(channelService, "://"):
+		return EnterpriseChannelEnvironment(channelService)
+	}
+	return ChannelEnvironment{}, errors.Errorf("Unknown channel service %s", channelService)
+}
+
+// EnterpriseChannelEnvironment returns the ChannelEnvironment of the enterprise channel service with
+// the given name. Tokens from an enterprise channel are signed with the keys referenced by its own
+// OpenID metadata, see ToBotFromEnterpriseChannelOpenIDMetadataURLFormat, and otherwise validated as
+// in the public cloud.
+func EnterpriseChannelEnvironment(channelService string) (ChannelEnvironment, error) {
+	if !enterpriseChannelServiceMatch.MatchString(channelService) {
+		return ChannelEnvironment{}, errors.Errorf("Invalid enterprise channel service %s", channelService)
+	}
+	environment := PublicCloud
+	environment.Name = "Enterprise"
+	environment.OpenIDMetadataURL = strings.Replace(ToBotFromEnterpriseChannelOpenIDMetadataURLFormat[0], "{channelService}", channelService, 1) +
+		ToBotFromEnterpriseChannelOpenIDMetadataURLFormat[1]
+	return environment, nil
+}
+
+// IsValidIssuer checks if the issuer is one of the TokenIssuers.
+func (ce ChannelEnvironment) IsValidIssuer(issuer string) bool {
+	return contains(ce.TokenIssuers, issuer)
+}
+
+// IsEmulatorIssuer checks if the issuer is one of the EmulatorTokenIssuers.
+func (ce ChannelEnvironment) IsEmulatorIssuer(issuer string) bool {
+	return ce.EmulatorOpenIDMetadataURL != "" && contains(ce.EmulatorTokenIssuers, issuer)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
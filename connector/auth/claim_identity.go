@@ -25,6 +25,8 @@ type Claim interface{}
 // ClaimsIdentity is the interface to process claims in a JWT token.
 type ClaimsIdentity interface {
 	GetClaimValue(string) string
+	GetClaim(string) (interface{}, bool)
+	Claims() map[string]interface{}
 	IsAuthenticated() bool
 }
 
@@ -54,8 +56,25 @@ func NewClaimIdentity(claims map[string]interface{}, isAuth bool) ClaimsIdentity
 }
 
 // GetClaimValue returns value for a specified property of a claim.
+// Returns an empty string if the claim is missing or not a string.
 func (ci DefaultClaimIdentity) GetClaimValue(cType string) string {
-	return ci.claims[cType].(string)
+	value, _ := ci.claims[cType].(string)
+	return value
+}
+
+// GetClaim returns the value of a claim and if the token has the claim.
+func (ci DefaultClaimIdentity) GetClaim(cType string) (interface{}, bool) {
+	value, ok := ci.claims[cType]
+	return value, ok
+}
+
+// Claims returns a copy of all claims of the token.
+func (ci DefaultClaimIdentity) Claims() map[string]interface{} {
+	claims := make(map[string]interface{}, len(ci.claims))
+	for cType, value := range ci.claims {
+		claims[cType] = value
+	}
+	return claims
 }
 
 // IsAuthenticated returns if the Claim is authenticated.
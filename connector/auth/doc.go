@@ -21,6 +21,8 @@
 Package auth provides authentication properties and functionalities for the connector service.
 
 TokenValidator provides the functionality for authenticating a JWT token in a received request.
+TokenSource provides the tokens for requests sent to the connector service, obtained with a client
+secret, a certificate, a managed identity or a federated token.
 Others provide the basic structures needed.
 */
 package auth
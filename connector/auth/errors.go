@@ -0,0 +1,92 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package auth
+
+import "errors"
+
+// The errors returned by TokenValidator when a token is rejected match one of these, using errors.Is.
+var (
+	// ErrMissingToken is matched when the request has no token or the token is malformed.
+	ErrMissingToken = errors.New("Unauthorized: missing or malformed token")
+
+	// ErrTokenExpired is matched when the token has expired.
+	ErrTokenExpired = errors.New("Unauthorized: token is expired")
+
+	// ErrTokenNotValidYet is matched when the token is used before its not before time.
+	ErrTokenNotValidYet = errors.New("Unauthorized: token is not valid yet")
+
+	// ErrInvalidSignature is matched when the token is not signed by a known key.
+	ErrInvalidSignature = errors.New("Unauthorized: invalid token signature")
+
+	// ErrInvalidAlgorithm is matched when the token is signed with an algorithm which is not allowed.
+	ErrInvalidAlgorithm = errors.New("Unauthorized: invalid signing algorithm")
+
+	// ErrInvalidIssuer is matched when the token is issued by an unknown issuer.
+	ErrInvalidIssuer = errors.New("Unauthorized: invalid token issuer")
+
+	// ErrInvalidAudience is matched when the token is intended for another app.
+	ErrInvalidAudience = errors.New("Unauthorized: invalid token audience")
+
+	// ErrInvalidServiceURL is matched when the token is issued for another service URL than the activity's.
+	ErrInvalidServiceURL = errors.New("Unauthorized: invalid service URL claim")
+
+	// ErrKeyNotEndorsed is matched when the key signing the token is not endorsed for the channel of the activity.
+	ErrKeyNotEndorsed = errors.New("Unauthorized: key is not endorsed for the channel")
+)
+
+// validationErrors are the errors above, checked by IsValidationError.
+var validationErrors = []error{
+	ErrMissingToken, ErrTokenExpired, ErrTokenNotValidYet, ErrInvalidSignature, ErrInvalidAlgorithm,
+	ErrInvalidIssuer, ErrInvalidAudience, ErrInvalidServiceURL, ErrKeyNotEndorsed,
+}
+
+// IsValidationError returns if err matches one of the errors above, i.e. the token was rejected, rather than
+// telling that the token could not be validated, e.g. because the OpenID metadata could not be fetched.
+func IsValidationError(err error) bool {
+	for _, kind := range validationErrors {
+		if errors.Is(err, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// validationError classifies an error with one of the sentinel errors above, keeping its message.
+type validationError struct {
+	kind error
+	err  error
+}
+
+func (ve validationError) Error() string {
+	return ve.err.Error()
+}
+
+func (ve validationError) Unwrap() error {
+	return ve.err
+}
+
+func (ve validationError) Is(target error) bool {
+	return target == ve.kind
+}
+
+// newValidationError returns an error of the given kind with the message.
+func newValidationError(kind error, message string) error {
+	return validationError{kind, errors.New(message)}
+}
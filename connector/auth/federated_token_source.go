@@ -0,0 +1,88 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package auth
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Environment variables set by Azure workload identity.
+const (
+	clientIDEnv           = "AZURE_CLIENT_ID"
+	federatedTokenFileEnv = "AZURE_FEDERATED_TOKEN_FILE"
+	authorityHostEnv      = "AZURE_AUTHORITY_HOST"
+)
+
+// FederatedTokenSource is a TokenSource requesting tokens with the client credentials grant, using as
+// client assertion a token issued by a trusted identity provider and written to TokenFile, as done by
+// Kubernetes workload identity.
+//
+// The file is read for every token request, as the identity provider rotates the token it holds.
+type FederatedTokenSource struct {
+	ClientID  string
+	TokenFile string
+	// LoginEndpoint is the login URL prefix, ToChannelFromBotLoginURLPrefix by default.
+	LoginEndpoint string
+	HTTPClient    *http.Client
+}
+
+// NewFederatedTokenSource returns a FederatedTokenSource for the app with the client ID, using the token in tokenFile.
+func NewFederatedTokenSource(clientID string, tokenFile string) *FederatedTokenSource {
+	return &FederatedTokenSource{ClientID: clientID, TokenFile: tokenFile}
+}
+
+// NewFederatedTokenSourceFromEnv returns a FederatedTokenSource configured by the AZURE_CLIENT_ID,
+// AZURE_FEDERATED_TOKEN_FILE and AZURE_AUTHORITY_HOST environment variables set by Azure workload identity.
+func NewFederatedTokenSourceFromEnv() (*FederatedTokenSource, error) {
+	ts := &FederatedTokenSource{
+		ClientID:      os.Getenv(clientIDEnv),
+		TokenFile:     os.Getenv(federatedTokenFileEnv),
+		LoginEndpoint: os.Getenv(authorityHostEnv),
+	}
+	if ts.ClientID == "" || ts.TokenFile == "" {
+		return nil, errors.Errorf("Missing %s or %s environment variable", clientIDEnv, federatedTokenFileEnv)
+	}
+	return ts, nil
+}
+
+// Token implements TokenSource.
+func (ts *FederatedTokenSource) Token(ctx context.Context, req TokenRequest) (Token, error) {
+	assertion, err := ioutil.ReadFile(ts.TokenFile)
+	if err != nil {
+		return Token{}, errors.Wrapf(err, "Failed to read federated token file %s.", ts.TokenFile)
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+	data.Set("client_id", ts.ClientID)
+	data.Set("scope", req.Scope)
+	data.Set("client_assertion_type", ClientAssertionType)
+	data.Set("client_assertion", string(bytes.TrimSpace(assertion)))
+
+	tokenURL := ToChannelFromBotTokenURL(loginEndpoint(ts.LoginEndpoint), tenant(req.Tenant))
+	return postTokenForm(ctx, ts.HTTPClient, tokenURL, data)
+}
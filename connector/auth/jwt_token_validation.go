@@ -21,11 +21,11 @@ package auth
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -34,8 +34,6 @@ import (
 	"github.com/lestrrat-go/jwx/jwk"
 )
 
-var metadataURL = "https://login.botframework.com/v1/.well-known/openidconfiguration"
-
 // Timeout for calls fetching the metadata and JWK URLs
 const fetchTimeout = 20
 
@@ -59,18 +57,66 @@ type TokenValidator interface {
 }
 
 // JwtTokenValidator is the default implementation of TokenValidator.
+//
+// KeyCache caches the JWKs used to verify the signature of tokens, by OpenID metadata URL.
+// Environment, if set, is used to validate tokens instead of the ChannelEnvironment selected by
+// the channel service passed to AuthenticateRequest.
+// Policy configures the validation of the claims and signature of tokens.
+// HTTPClient, if set, is used to fetch OpenID metadata documents and JWKs.
 type JwtTokenValidator struct {
-	cache.AuthCache
+	KeyCache    cache.Cache
+	Environment *ChannelEnvironment
+	Policy      ValidationPolicy
+	HTTPClient  *http.Client
+
+	mu sync.Mutex
+	// refreshedAt holds when the keys were last refreshed for an unknown key ID, by OpenID metadata URL
+	refreshedAt map[string]time.Time
+}
+
+// ValidatorOption configures a JwtTokenValidator.
+type ValidatorOption func(*JwtTokenValidator)
+
+// WithChannelEnvironment validates tokens with the endpoints of the environment, like a custom cloud.
+func WithChannelEnvironment(environment ChannelEnvironment) ValidatorOption {
+	return func(jv *JwtTokenValidator) {
+		jv.Environment = &environment
+	}
+}
+
+// WithValidationPolicy validates tokens according to the policy instead of DefaultValidationPolicy.
+func WithValidationPolicy(policy ValidationPolicy) ValidatorOption {
+	return func(jv *JwtTokenValidator) {
+		jv.Policy = policy
+	}
+}
+
+// WithHTTPClient fetches OpenID metadata documents and JWKs with the client.
+func WithHTTPClient(client *http.Client) ValidatorOption {
+	return func(jv *JwtTokenValidator) {
+		jv.HTTPClient = client
+	}
 }
 
 // NewJwtTokenValidator returns a new TokenValidator value with an empty cache
-func NewJwtTokenValidator() TokenValidator {
-	return &JwtTokenValidator{cache.AuthCache{}}
+func NewJwtTokenValidator(options ...ValidatorOption) TokenValidator {
+	jv := &JwtTokenValidator{
+		KeyCache: cache.NewRefreshingCache(metadataRefreshBefore),
+		Policy:   DefaultValidationPolicy(),
+	}
+	for _, option := range options {
+		option(jv)
+	}
+	return jv
 }
 
 // AuthenticateRequest authenticates the received request from connector service.
 //
 // The Bearer token is validated for the correct issuer, audience, serviceURL expiry and the signature is verified using the public JWK fetched from BotFramework API.
+// The issuers and the OpenID metadata are those of the ChannelEnvironment selected by channelService, see ChannelEnvironmentForService.
+// Tokens from the Bot Framework Emulator are validated against the emulator OpenID metadata of the environment instead.
+//
+// Errors for rejected tokens match one of the sentinel errors like ErrTokenExpired, using errors.Is.
 func (jv *JwtTokenValidator) AuthenticateRequest(ctx context.Context, activity schema.Activity, authHeader string, credentials CredentialProvider, channelService string) (ClaimsIdentity, error) {
 	// Check the format of the auth header
 	match := authHeaderMatch.FindStringSubmatch(strings.TrimSpace(authHeader))
@@ -78,21 +124,30 @@ func (jv *JwtTokenValidator) AuthenticateRequest(ctx context.Context, activity s
 		if credentials.IsAuthenticationDisabled() {
 			return nil, nil
 		}
-		return nil, errors.New("Unauthorized Access. Request is not authorized")
+		return nil, newValidationError(ErrMissingToken, "Unauthorized Access. Request is not authorized")
+	}
+
+	environment, err := jv.environment(channelService)
+	if err != nil {
+		return nil, err
 	}
 
-	identity, err := jv.getIdentity(match[1])
+	if environment.IsEmulatorIssuer(unverifiedIssuer(match[1])) {
+		return jv.authenticateEmulatorToken(ctx, match[1], activity.ChannelID, credentials, environment)
+	}
+
+	identity, err := jv.getIdentity(ctx, environment.OpenIDMetadataURL, match[1], activity.ChannelID)
 	if err != nil || !identity.IsAuthenticated() {
 		return nil, err
 	}
 
 	// Validate serviceURL
 	// This is done outside validateIdentity method to have provision for channel based authentication in future.
-	if identity.GetClaimValue("serviceurl") != activity.ServiceURL {
-		return nil, errors.New("Unauthorized, service_url claim is invalid")
+	if identity.GetClaimValue(ServiceURLClaim) != activity.ServiceURL {
+		return nil, newValidationError(ErrInvalidServiceURL, "Unauthorized, service_url claim is invalid")
 	}
 
-	err = jv.validateIdentity(identity, credentials)
+	err = jv.validateIdentity(identity, credentials, environment)
 	if err != nil {
 		return nil, err
 	}
@@ -100,37 +155,88 @@ func (jv *JwtTokenValidator) AuthenticateRequest(ctx context.Context, activity s
 	return identity, nil
 }
 
-func (jv *JwtTokenValidator) getIdentity(jwtString string) (ClaimsIdentity, error) {
+// authenticateEmulatorToken authenticates a token issued by Azure AD for the Bot Framework Emulator.
+//
+// Emulator tokens carry the app ID in the appid claim for v1 tokens and in the azp claim for v2 tokens,
+// and have no service URL claim.
+func (jv *JwtTokenValidator) authenticateEmulatorToken(ctx context.Context, jwtString string, channelID string, credentials CredentialProvider, environment ChannelEnvironment) (ClaimsIdentity, error) {
+	identity, err := jv.getIdentity(ctx, environment.EmulatorOpenIDMetadataURL, jwtString, channelID)
+	if err != nil || !identity.IsAuthenticated() {
+		return nil, err
+	}
+
+	if !environment.IsEmulatorIssuer(identity.GetClaimValue(IssuerClaim)) {
+		return nil, newValidationError(ErrInvalidIssuer, "Unauthorized: invalid token issuer")
+	}
+
+	var appID string
+	switch version := identity.GetClaimValue(VersionClaim); version {
+	case "", "1.0":
+		appID = identity.GetClaimValue(AppIDClaim)
+	case "2.0":
+		appID = identity.GetClaimValue(AuthorizedParty)
+	default:
+		return nil, newValidationError(ErrMissingToken, "Unauthorized: unknown emulator token version "+version)
+	}
+	if appID == "" || !credentials.IsValidAppID(appID) {
+		return nil, newValidationError(ErrInvalidAudience, "Unauthorized: invalid AppId passed on token")
+	}
+
+	return identity, nil
+}
+
+// unverifiedIssuer returns the issuer of the token without verifying it, to decide how to validate it.
+func unverifiedIssuer(jwtString string) string {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(jwtString, claims); err != nil {
+		return ""
+	}
+	issuer, _ := claims[IssuerClaim].(string)
+	return issuer
+}
+
+func (jv *JwtTokenValidator) environment(channelService string) (ChannelEnvironment, error) {
+	if jv.Environment != nil {
+		return *jv.Environment, nil
+	}
+	return ChannelEnvironmentForService(channelService)
+}
+
+// getIdentity verifies the token with the keys referenced by the OpenID metadata document. The key which
+// signed the token must be endorsed for the channel of the activity, if it lists its endorsements.
+// The signing algorithm, expiry and not before time are checked according to the Policy.
+func (jv *JwtTokenValidator) getIdentity(ctx context.Context, metadataURL string, jwtString string, channelID string) (ClaimsIdentity, error) {
+	algorithms := jv.Policy.algorithms()
 
 	getKey := func(token *jwt.Token) (interface{}, error) {
+		if !contains(algorithms, token.Method.Alg()) {
+			return nil, newValidationError(ErrInvalidAlgorithm, "Unauthorized. Invalid signing algorithm")
+		}
+
+		keyID, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, newValidationError(ErrInvalidSignature, "Expecting JWT header to have string kid")
+		}
 
-		jwksURL, err := jv.getJwkURL(metadataURL)
+		keys, err := jv.getKeys(ctx, metadataURL)
 		if err != nil {
 			return nil, err
 		}
-
-		// Get new JWKs if the cache is expired
-		if jv.AuthCache.IsExpired() {
-			ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout*time.Second)
-			defer cancel()
-			set, err := jwk.Fetch(ctx, jwksURL)
+		key, ok := keys.LookupKeyID(keyID)
+		if !ok {
+			// The keys may have been rotated since they were cached
+			refreshed, err := jv.refreshKeys(ctx, metadataURL)
 			if err != nil {
 				return nil, err
 			}
-			// Update the cache
-			// The expiry time is set to be of 5 days
-			jv.AuthCache = cache.AuthCache{
-				Keys:   set,
-				Expiry: time.Now().Add(time.Hour * 24 * 5),
+			if refreshed != nil {
+				key, ok = refreshed.LookupKeyID(keyID)
 			}
 		}
-		keyID, ok := token.Header["kid"].(string)
-		if !ok {
-			return nil, errors.New("Expecting JWT header to have string kid")
-		}
-		// Return cached JWKs
-		key, ok := jv.AuthCache.Keys.(jwk.Set).LookupKeyID(keyID)
 		if ok {
+			if !isEndorsed(key, channelID) {
+				return nil, newValidationError(ErrKeyNotEndorsed, "Unauthorized: key is not endorsed for channel "+channelID)
+			}
 			var rawKey interface{}
 			err := key.Raw(&rawKey)
 			if err != nil {
@@ -139,59 +245,99 @@ func (jv *JwtTokenValidator) getIdentity(jwtString string) (ClaimsIdentity, erro
 			return rawKey, nil
 		}
 
-		return nil, errors.New("Could not find public key")
+		return nil, newValidationError(ErrInvalidSignature, "Could not find public key")
 	}
 
-	// TODO: Add options verify_aud and verify_exp
-	token, err := jwt.Parse(jwtString, getKey)
+	// The claims are validated below, with the clock skew of the policy
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(jwtString, getKey)
 	if err != nil {
-		return nil, err
+		return nil, classifyParseError(err)
 	}
 
-	// Check allowed signing algorithms
-	alg := token.Header["alg"]
-	isAllowed := func() bool {
-		for _, allowed := range AllowedSigningAlgorithms {
-			if allowed == alg {
-				return true
-			}
-		}
-		return false
-	}()
-
-	if !isAllowed {
-		return nil, errors.New("Unauthorized. Invalid signing algorithm")
+	claims := token.Claims.(jwt.MapClaims)
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-jv.Policy.ClockSkew).Unix(), true) {
+		return nil, newValidationError(ErrTokenExpired, "Unauthorized: token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(jv.Policy.ClockSkew).Unix(), false) {
+		return nil, newValidationError(ErrTokenNotValidYet, "Unauthorized: token is not valid yet")
 	}
 
-	claims := token.Claims.(jwt.MapClaims)
 	return NewClaimIdentity(claims, true), nil
 }
 
-func (jv *JwtTokenValidator) validateIdentity(identity ClaimsIdentity, credentials CredentialProvider) error {
-	// check issuer
-	if identity.GetClaimValue(IssuerClaim) != ToBotFromChannelTokenIssuer {
-		return errors.New("Unauthorized: invalid token issuer")
+// classifyParseError returns the error of the key function, or classifies the error of the parser.
+func classifyParseError(err error) error {
+	var parseErr *jwt.ValidationError
+	if !errors.As(err, &parseErr) {
+		return err
 	}
-
-	// check App ID
-	if !credentials.IsValidAppID(identity.GetClaimValue(AudienceClaim)) {
-		return errors.New("Unauthorized: invalid AppId passed on token")
+	if parseErr.Inner != nil {
+		var kindErr validationError
+		if errors.As(parseErr.Inner, &kindErr) {
+			return kindErr
+		}
 	}
+	switch {
+	case parseErr.Errors&jwt.ValidationErrorMalformed != 0:
+		return validationError{ErrMissingToken, err}
+	case parseErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return validationError{ErrInvalidSignature, err}
+	}
+	return err
+}
 
+// audiences returns the audiences of the token, which the aud claim holds as a string or an array.
+func audiences(identity ClaimsIdentity) []string {
+	value, _ := identity.GetClaim(AudienceClaim)
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var audiences []string
+		for _, audience := range value {
+			if audience, ok := audience.(string); ok {
+				audiences = append(audiences, audience)
+			}
+		}
+		return audiences
+	}
 	return nil
 }
 
-type metadata struct {
-	JwksURI string `json:"jwks_uri"`
+// isEndorsed checks if the key may sign tokens for activities from the channel, as listed by the
+// endorsements of the key. Keys without endorsements and activities without channel ID are not restricted.
+func isEndorsed(key jwk.Key, channelID string) bool {
+	value, ok := key.Get(EndorsementsKey)
+	if !ok || channelID == "" {
+		return true
+	}
+
+	var endorsements []string
+	switch value := value.(type) {
+	case []string:
+		endorsements = value
+	case []interface{}:
+		for _, endorsement := range value {
+			if endorsement, ok := endorsement.(string); ok {
+				endorsements = append(endorsements, endorsement)
+			}
+		}
+	}
+	return contains(endorsements, channelID)
 }
 
-func (jv JwtTokenValidator) getJwkURL(metadataURL string) (string, error) {
-	response, err := httpClient.Get(metadataURL)
-	if err != nil {
-		return "", errors.New("Error getting metadata document")
+func (jv *JwtTokenValidator) validateIdentity(identity ClaimsIdentity, credentials CredentialProvider, environment ChannelEnvironment) error {
+	// check issuer
+	if !jv.Policy.isValidIssuer(identity.GetClaimValue(IssuerClaim), environment) {
+		return newValidationError(ErrInvalidIssuer, "Unauthorized: invalid token issuer")
 	}
 
-	data := metadata{}
-	err = json.NewDecoder(response.Body).Decode(&data)
-	return data.JwksURI, err
+	// check App ID
+	if !jv.Policy.isValidAudience(audiences(identity), credentials) {
+		return newValidationError(ErrInvalidAudience, "Unauthorized: invalid AppId passed on token")
+	}
+
+	return nil
 }
@@ -0,0 +1,523 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/infracloudio/msbotbuilder-go/connector/auth"
+	"github.com/infracloudio/msbotbuilder-go/connector/cache"
+	"github.com/infracloudio/msbotbuilder-go/schema"
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testKeyID      = "test-key"
+	testAppID      = "app-id"
+	testServiceURL = "https://smba.trafficmanager.net/amer/"
+)
+
+// testIssuer serves an OpenID metadata document and the JWK of the key signing its tokens, with
+// its endorsements if not nil and the cacheControl header if set. keyRequests counts the requests
+// for the JWK.
+type testIssuer struct {
+	key          *rsa.PrivateKey
+	keyID        string
+	endorsements []string
+	cacheControl string
+	keyRequests  int32
+	unavailable  int32
+	srv          *httptest.Server
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	ti := &testIssuer{key: key, keyID: testKeyID}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/.well-known/openidconfiguration", func(w http.ResponseWriter, r *http.Request) {
+		if ti.cacheControl != "" {
+			w.Header().Set("Cache-Control", ti.cacheControl)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": ti.srv.URL + "/v1/.well-known/keys"})
+	})
+	mux.HandleFunc("/v1/.well-known/keys", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&ti.keyRequests, 1)
+		if atomic.LoadInt32(&ti.unavailable) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if ti.cacheControl != "" {
+			w.Header().Set("Cache-Control", ti.cacheControl)
+		}
+		jwk := map[string]interface{}{
+			"kty": "RSA",
+			"use": "sig",
+			"kid": ti.keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(ti.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(ti.key.E)).Bytes()),
+		}
+		if ti.endorsements != nil {
+			jwk["endorsements"] = ti.endorsements
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]interface{}{jwk}})
+	})
+	ti.srv = httptest.NewServer(mux)
+	t.Cleanup(ti.srv.Close)
+	return ti
+}
+
+// rotateKey replaces the key signing the tokens of the issuer.
+func (ti *testIssuer) rotateKey(t *testing.T, keyID string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	ti.key, ti.keyID = key, keyID
+}
+
+// channelEnvironment returns an environment trusting the tokens of the issuer.
+func (ti *testIssuer) channelEnvironment() *auth.ChannelEnvironment {
+	environment := auth.PublicCloud
+	environment.OpenIDMetadataURL = ti.metadataURL()
+	return &environment
+}
+
+func (ti *testIssuer) metadataURL() string {
+	return ti.srv.URL + "/v1/.well-known/openidconfiguration"
+}
+
+// authHeader returns the Authorization header with a token signed by the issuer.
+func (ti *testIssuer) authHeader(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = ti.keyID
+	signed, err := token.SignedString(ti.key)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	return "Bearer " + signed
+}
+
+// channelClaims returns the claims of a token from a channel in the environment.
+func channelClaims(issuer string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":        issuer,
+		"aud":        testAppID,
+		"serviceurl": testServiceURL,
+		"exp":        time.Now().Add(time.Hour).Unix(),
+		"nbf":        time.Now().Add(-time.Minute).Unix(),
+	}
+}
+
+func TestAuthenticateRequestEnvironment(t *testing.T) {
+	ti := newTestIssuer(t)
+	public := auth.PublicCloud
+	public.OpenIDMetadataURL = ti.metadataURL()
+	government := auth.USGovernmentCloud
+	government.OpenIDMetadataURL = ti.metadataURL()
+
+	tests := []struct {
+		name        string
+		environment auth.ChannelEnvironment
+		claims      jwt.MapClaims
+		valid       bool
+	}{
+		{"public cloud", public, channelClaims(auth.ToBotFromChannelTokenIssuer), true},
+		{"government cloud", government, channelClaims(auth.ToBotFromChannelTokenIssuerGov), true},
+		{"government issuer in public cloud", public, channelClaims(auth.ToBotFromChannelTokenIssuerGov), false},
+		{"public issuer in government cloud", government, channelClaims(auth.ToBotFromChannelTokenIssuer), false},
+	}
+	credentials := auth.SimpleCredentialProvider{AppID: testAppID, Password: "secret"}
+	activity := schema.Activity{ServiceURL: testServiceURL}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validator := auth.NewJwtTokenValidator(auth.WithChannelEnvironment(test.environment))
+			identity, err := validator.AuthenticateRequest(context.Background(), activity, ti.authHeader(t, test.claims), credentials, "")
+			if test.valid {
+				assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+				assert.True(t, identity.IsAuthenticated(), "Expect authenticated identity")
+			} else {
+				assert.NotNil(t, err, "Expect invalid issuer to be rejected")
+			}
+		})
+	}
+}
+
+func TestChannelEnvironmentForService(t *testing.T) {
+	environment, err := auth.ChannelEnvironmentForService("")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, auth.PublicCloud, environment, "Expect public cloud by default")
+
+	environment, err = auth.ChannelEnvironmentForService(auth.ChannelService)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, auth.PublicCloud, environment, "Expect public cloud for the setting key")
+
+	environment, err = auth.ChannelEnvironmentForService(auth.GovernmentChannelService)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, auth.USGovernmentCloud, environment, "Expect US Government cloud")
+	assert.Equal(t, "https://login.microsoftonline.us/MicrosoftServices.onmicrosoft.com/oauth2/v2.0/token",
+		auth.ToChannelFromBotTokenURL(environment.LoginEndpoint, environment.ChannelAuthTenant), "Expect government token URL")
+
+	_, err = auth.ChannelEnvironmentForService("https://unknown.example.com")
+	assert.NotNil(t, err, "Expect error for unknown channel service")
+}
+
+func TestEnterpriseChannelEnvironment(t *testing.T) {
+	environment, err := auth.ChannelEnvironmentForService("contoso")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, "https://contoso.enterprisechannel.botframework.com/v1/.well-known/openidconfiguration", environment.OpenIDMetadataURL, "Expect enterprise metadata URL")
+	assert.Equal(t, auth.PublicCloud.TokenIssuers, environment.TokenIssuers, "Expect public cloud issuers")
+
+	_, err = auth.EnterpriseChannelEnvironment("evil.com/path?")
+	assert.NotNil(t, err, "Expect error for invalid channel service")
+}
+
+func TestKeysCachedPerMetadataURL(t *testing.T) {
+	// Both issuers sign with different keys using the same key ID
+	first, second := newTestIssuer(t), newTestIssuer(t)
+	firstEnvironment, err := auth.EnterpriseChannelEnvironment("first")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	firstEnvironment.OpenIDMetadataURL = first.metadataURL()
+	secondEnvironment := firstEnvironment
+	secondEnvironment.OpenIDMetadataURL = second.metadataURL()
+
+	validator := auth.NewJwtTokenValidator().(*auth.JwtTokenValidator)
+	credentials := auth.SimpleCredentialProvider{AppID: testAppID, Password: "secret"}
+	activity := schema.Activity{ServiceURL: testServiceURL}
+	claims := channelClaims(auth.ToBotFromChannelTokenIssuer)
+
+	for _, test := range []struct {
+		environment auth.ChannelEnvironment
+		issuer      *testIssuer
+		valid       bool
+	}{
+		{firstEnvironment, first, true},
+		{secondEnvironment, second, true},
+		{firstEnvironment, second, false},
+	} {
+		environment := test.environment
+		validator.Environment = &environment
+		_, err := validator.AuthenticateRequest(context.Background(), activity, test.issuer.authHeader(t, claims), credentials, "")
+		assert.Equal(t, test.valid, err == nil, fmt.Sprintf("Unexpected result %v", err))
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	issuer := newTestIssuer(t)
+	validator := auth.NewJwtTokenValidator(auth.WithChannelEnvironment(*issuer.channelEnvironment()))
+	credentials := auth.SimpleCredentialProvider{AppID: testAppID, Password: "secret"}
+	activity := schema.Activity{ServiceURL: testServiceURL}
+	claims := channelClaims(auth.ToBotFromChannelTokenIssuer)
+
+	for _, test := range []struct {
+		name        string
+		keyID       string
+		valid       bool
+		keyRequests int32
+	}{
+		{"Keys fetched", "", true, 1},
+		{"Keys cached", "", true, 1},
+		{"Keys refreshed for unknown key ID", "rotated-key", true, 2},
+		{"Refresh rate limited", "rotated-again-key", false, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.keyID != "" {
+				issuer.rotateKey(t, test.keyID)
+			}
+			_, err := validator.AuthenticateRequest(context.Background(), activity, issuer.authHeader(t, claims), credentials, "")
+			assert.Equal(t, test.valid, err == nil, fmt.Sprintf("Unexpected result %v", err))
+			if !test.valid {
+				assert.True(t, errors.Is(err, auth.ErrInvalidSignature), fmt.Sprintf("Unexpected error %v", err))
+			}
+			assert.Equal(t, test.keyRequests, atomic.LoadInt32(&issuer.keyRequests))
+		})
+	}
+}
+
+func TestKeyRefreshFailure(t *testing.T) {
+	issuer := newTestIssuer(t)
+	validator := auth.NewJwtTokenValidator(auth.WithChannelEnvironment(*issuer.channelEnvironment()))
+	credentials := auth.SimpleCredentialProvider{AppID: testAppID, Password: "secret"}
+	activity := schema.Activity{ServiceURL: testServiceURL}
+	claims := channelClaims(auth.ToBotFromChannelTokenIssuer)
+
+	_, err := validator.AuthenticateRequest(context.Background(), activity, issuer.authHeader(t, claims), credentials, "")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	atomic.StoreInt32(&issuer.unavailable, 1)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "unknown-key"
+	signed, err := token.SignedString(issuer.key)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	_, err = validator.AuthenticateRequest(context.Background(), activity, "Bearer "+signed, credentials, "")
+	assert.NotNil(t, err, "Expect error when the keys cannot be refreshed")
+	assert.False(t, auth.IsValidationError(err), fmt.Sprintf("Expect the fetch error, got %v", err))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&issuer.keyRequests), "Expect keys to be fetched again")
+
+	_, err = validator.AuthenticateRequest(context.Background(), activity, issuer.authHeader(t, claims), credentials, "")
+	assert.Nil(t, err, "Expect the cached keys to be kept after a failed refresh")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&issuer.keyRequests), "Expect the cached keys to be used")
+}
+
+// expiryCache records the expiry of the fetched values without caching them.
+type expiryCache map[string]time.Time
+
+func (c expiryCache) Get(ctx context.Context, key string, fetch cache.FetchFunc) (interface{}, error) {
+	value, expiry, err := fetch(ctx)
+	c[key] = expiry
+	return value, err
+}
+
+func (c expiryCache) Invalidate(key string) {}
+
+func TestKeysCacheControl(t *testing.T) {
+	issuer := newTestIssuer(t)
+	credentials := auth.SimpleCredentialProvider{AppID: testAppID, Password: "secret"}
+	activity := schema.Activity{ServiceURL: testServiceURL}
+
+	for _, test := range []struct {
+		cacheControl string
+		expiry       time.Duration
+	}{
+		{"public, max-age=3600", time.Hour},
+		{"max-age=1", 5 * time.Minute},
+		{"no-cache", 5 * time.Minute},
+		{"max-age=31536000", 5 * 24 * time.Hour},
+		{"", 24 * time.Hour},
+	} {
+		issuer.cacheControl = test.cacheControl
+		keyCache := expiryCache{}
+		validator := &auth.JwtTokenValidator{KeyCache: keyCache, Environment: issuer.channelEnvironment(), Policy: auth.DefaultValidationPolicy()}
+		start := time.Now()
+		_, err := validator.AuthenticateRequest(context.Background(), activity, issuer.authHeader(t, channelClaims(auth.ToBotFromChannelTokenIssuer)), credentials, "")
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+		assert.Len(t, keyCache, 2, "Expect the metadata and keys to be cached")
+		for key, expiry := range keyCache {
+			assert.WithinDuration(t, start.Add(test.expiry), expiry, 5*time.Second, fmt.Sprintf("Unexpected expiry of %s for %q", key, test.cacheControl))
+		}
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	issuer := newTestIssuer(t)
+	var requests int32
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+	validator := auth.NewJwtTokenValidator(auth.WithChannelEnvironment(*issuer.channelEnvironment()), auth.WithHTTPClient(client))
+
+	credentials := auth.SimpleCredentialProvider{AppID: testAppID, Password: "secret"}
+	activity := schema.Activity{ServiceURL: testServiceURL}
+	_, err := validator.AuthenticateRequest(context.Background(), activity, issuer.authHeader(t, channelClaims(auth.ToBotFromChannelTokenIssuer)), credentials, "")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests), "Expect the metadata and keys fetched with the client")
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestAuthenticateEmulatorToken(t *testing.T) {
+	emulator, channel := newTestIssuer(t), newTestIssuer(t)
+	environment := auth.PublicCloud
+	environment.OpenIDMetadataURL = channel.metadataURL()
+	environment.EmulatorOpenIDMetadataURL = emulator.metadataURL()
+	validator := auth.NewJwtTokenValidator(auth.WithChannelEnvironment(environment))
+	credentials := auth.SimpleCredentialProvider{AppID: testAppID, Password: "secret"}
+
+	emulatorClaims := func(version string, claims jwt.MapClaims) jwt.MapClaims {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		if version == "2.0" {
+			claims["iss"] = auth.ToBotFromEmulatorTokenIssuers[1]
+		} else {
+			claims["iss"] = auth.ToBotFromEmulatorTokenIssuers[0]
+		}
+		if version != "" {
+			claims["ver"] = version
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		issuer *testIssuer
+		claims jwt.MapClaims
+		valid  bool
+	}{
+		{"v1 token", emulator, emulatorClaims("1.0", jwt.MapClaims{"appid": testAppID}), true},
+		{"token without version", emulator, emulatorClaims("", jwt.MapClaims{"appid": testAppID}), true},
+		{"v2 token", emulator, emulatorClaims("2.0", jwt.MapClaims{"azp": testAppID}), true},
+		{"v2 token of other app", emulator, emulatorClaims("2.0", jwt.MapClaims{"azp": "other-app-id", "appid": testAppID}), false},
+		{"v1 token without appid", emulator, emulatorClaims("1.0", jwt.MapClaims{"azp": testAppID}), false},
+		{"unknown version", emulator, emulatorClaims("3.0", jwt.MapClaims{"appid": testAppID, "azp": testAppID}), false},
+		{"signed with channel key", channel, emulatorClaims("1.0", jwt.MapClaims{"appid": testAppID}), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identity, err := validator.AuthenticateRequest(context.Background(), schema.Activity{}, test.issuer.authHeader(t, test.claims), credentials, "")
+			if test.valid {
+				assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+				assert.True(t, identity.IsAuthenticated(), "Expect authenticated identity")
+			} else {
+				assert.NotNil(t, err, "Expect token to be rejected")
+			}
+		})
+	}
+}
+
+func TestEndorsements(t *testing.T) {
+	tests := []struct {
+		name         string
+		endorsements []string
+		channelID    string
+		valid        bool
+	}{
+		{"endorsed channel", []string{"msteams", "webchat"}, "msteams", true},
+		{"channel not endorsed", []string{"webchat"}, "msteams", false},
+		{"no endorsed channel", []string{}, "msteams", false},
+		{"activity without channel", []string{"webchat"}, "", true},
+		{"key without endorsements", nil, "msteams", true},
+	}
+	credentials := auth.SimpleCredentialProvider{AppID: testAppID, Password: "secret"}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ti := newTestIssuer(t)
+			ti.endorsements = test.endorsements
+			environment := auth.PublicCloud
+			environment.OpenIDMetadataURL = ti.metadataURL()
+			validator := auth.NewJwtTokenValidator(auth.WithChannelEnvironment(environment))
+
+			activity := schema.Activity{ServiceURL: testServiceURL, ChannelID: test.channelID}
+			authHeader := ti.authHeader(t, channelClaims(auth.ToBotFromChannelTokenIssuer))
+			_, err := validator.AuthenticateRequest(context.Background(), activity, authHeader, credentials, "")
+			assert.Equal(t, test.valid, err == nil, fmt.Sprintf("Unexpected result %v", err))
+		})
+	}
+}
+
+func TestValidationPolicy(t *testing.T) {
+	ti, other := newTestIssuer(t), newTestIssuer(t)
+	environment := auth.PublicCloud
+	environment.OpenIDMetadataURL = ti.metadataURL()
+
+	withClaims := func(changes jwt.MapClaims) jwt.MapClaims {
+		claims := channelClaims(auth.ToBotFromChannelTokenIssuer)
+		for claim, value := range changes {
+			if value == nil {
+				delete(claims, claim)
+				continue
+			}
+			claims[claim] = value
+		}
+		return claims
+	}
+	ago := func(d time.Duration) int64 { return time.Now().Add(-d).Unix() }
+
+	tests := []struct {
+		name   string
+		policy *auth.ValidationPolicy
+		issuer *testIssuer
+		claims jwt.MapClaims
+		header string
+		err    error
+	}{
+		{name: "valid token", claims: withClaims(nil)},
+		{name: "expired within clock skew", claims: withClaims(jwt.MapClaims{"exp": ago(time.Minute)})},
+		{name: "expired", claims: withClaims(jwt.MapClaims{"exp": ago(10 * time.Minute)}), err: auth.ErrTokenExpired},
+		{name: "expired without clock skew", policy: &auth.ValidationPolicy{}, claims: withClaims(jwt.MapClaims{"exp": ago(time.Minute)}), err: auth.ErrTokenExpired},
+		{name: "missing expiry", claims: withClaims(jwt.MapClaims{"exp": nil}), err: auth.ErrTokenExpired},
+		{name: "not valid yet within clock skew", claims: withClaims(jwt.MapClaims{"nbf": ago(-time.Minute)})},
+		{name: "not valid yet", claims: withClaims(jwt.MapClaims{"nbf": ago(-10 * time.Minute)}), err: auth.ErrTokenNotValidYet},
+		{name: "other audience", claims: withClaims(jwt.MapClaims{"aud": "other-app-id"}), err: auth.ErrInvalidAudience},
+		{name: "allowed audience", policy: &auth.ValidationPolicy{Audiences: []string{"other-app-id"}}, claims: withClaims(jwt.MapClaims{"aud": "other-app-id"})},
+		{name: "audience array", claims: withClaims(jwt.MapClaims{"aud": []string{"other-app-id", testAppID}})},
+		{name: "missing audience", claims: withClaims(jwt.MapClaims{"aud": nil}), err: auth.ErrInvalidAudience},
+		{name: "allowed issuer", policy: &auth.ValidationPolicy{Issuers: []string{"https://issuer.example.com"}}, claims: withClaims(jwt.MapClaims{"iss": "https://issuer.example.com"})},
+		{name: "issuer not allowed", policy: &auth.ValidationPolicy{Issuers: []string{"https://issuer.example.com"}}, claims: withClaims(nil), err: auth.ErrInvalidIssuer},
+		{name: "algorithm not allowed", policy: &auth.ValidationPolicy{Algorithms: []string{"RS512"}}, claims: withClaims(nil), err: auth.ErrInvalidAlgorithm},
+		{name: "signed by other key", issuer: other, claims: withClaims(nil), err: auth.ErrInvalidSignature},
+		{name: "other service URL", claims: withClaims(jwt.MapClaims{"serviceurl": "https://other.example.com/"}), err: auth.ErrInvalidServiceURL},
+		{name: "malformed token", header: "Bearer abc.def.ghi", err: auth.ErrMissingToken},
+		{name: "missing token", header: "Bearer", err: auth.ErrMissingToken},
+	}
+	credentials := auth.SimpleCredentialProvider{AppID: testAppID, Password: "secret"}
+	activity := schema.Activity{ServiceURL: testServiceURL}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := auth.DefaultValidationPolicy()
+			if test.policy != nil {
+				policy = *test.policy
+			}
+			validator := auth.NewJwtTokenValidator(auth.WithChannelEnvironment(environment), auth.WithValidationPolicy(policy))
+
+			header := test.header
+			if header == "" {
+				issuer := test.issuer
+				if issuer == nil {
+					issuer = ti
+				}
+				header = issuer.authHeader(t, test.claims)
+			}
+			_, err := validator.AuthenticateRequest(context.Background(), activity, header, credentials, "")
+			if test.err == nil {
+				assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+			} else {
+				assert.True(t, errors.Is(err, test.err), fmt.Sprintf("Expect %v, got %v", test.err, err))
+			}
+		})
+	}
+}
+
+func TestClaimsIdentity(t *testing.T) {
+	identity := auth.NewClaimIdentity(map[string]interface{}{"iss": "issuer", "aud": []interface{}{"a", "b"}}, true)
+
+	assert.Equal(t, "issuer", identity.GetClaimValue("iss"), "Expect string claim")
+	assert.Equal(t, "", identity.GetClaimValue("aud"), "Expect empty value for non-string claim")
+	assert.Equal(t, "", identity.GetClaimValue("ver"), "Expect empty value for missing claim")
+
+	value, ok := identity.GetClaim("aud")
+	assert.True(t, ok, "Expect claim")
+	assert.Equal(t, []interface{}{"a", "b"}, value, "Expect claim value")
+	_, ok = identity.GetClaim("ver")
+	assert.False(t, ok, "Expect missing claim")
+
+	claims := identity.Claims()
+	claims["iss"] = "changed"
+	assert.Equal(t, "issuer", identity.GetClaimValue("iss"), "Expect Claims to return a copy")
+}
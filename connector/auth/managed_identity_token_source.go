@@ -0,0 +1,79 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultManagedIdentityEndpoint is the token endpoint of the Azure Instance Metadata Service (IMDS).
+const DefaultManagedIdentityEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// managedIdentityAPIVersion is the version of the IMDS token API used.
+const managedIdentityAPIVersion = "2018-02-01"
+
+// ManagedIdentityTokenSource is a TokenSource obtaining the tokens of an Azure managed identity from
+// an IMDS-style endpoint.
+//
+// The tokens are issued by the tenant of the managed identity, so the Tenant of the TokenRequest is ignored.
+type ManagedIdentityTokenSource struct {
+	// ClientID selects a user-assigned managed identity. The system-assigned identity is used if empty.
+	ClientID string
+	// Endpoint is the token endpoint, DefaultManagedIdentityEndpoint by default.
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+// NewManagedIdentityTokenSource returns a ManagedIdentityTokenSource for the managed identity with the
+// client ID, or for the system-assigned identity if clientID is empty.
+func NewManagedIdentityTokenSource(clientID string) *ManagedIdentityTokenSource {
+	return &ManagedIdentityTokenSource{ClientID: clientID}
+}
+
+// Token implements TokenSource.
+func (ts *ManagedIdentityTokenSource) Token(ctx context.Context, req TokenRequest) (Token, error) {
+	endpoint := ts.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultManagedIdentityEndpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return Token{}, err
+	}
+
+	// IMDS expects the resource rather than the scope
+	query := u.Query()
+	query.Set("api-version", managedIdentityAPIVersion)
+	query.Set("resource", strings.TrimSuffix(req.Scope, "/.default"))
+	if ts.ClientID != "" {
+		query.Set("client_id", ts.ClientID)
+	}
+	u.RawQuery = query.Encode()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Token{}, err
+	}
+	r.Header.Set("Metadata", "true")
+	return requestToken(ts.HTTPClient, r)
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/connector/cache"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// OpenID metadata documents and JWKs are cached as long as allowed by the Cache-Control or Expires
+// headers of their responses, within these bounds, and refreshed in the background shortly before.
+const (
+	defaultMetadataExpiry = 24 * time.Hour
+	minMetadataExpiry     = 5 * time.Minute
+	maxMetadataExpiry     = 5 * 24 * time.Hour
+	metadataRefreshBefore = time.Minute
+)
+
+// keyRefreshInterval is the minimum interval between refreshes of the keys for an unknown key ID, so
+// that tokens with made up key IDs cannot flood the OpenID metadata endpoints.
+const keyRefreshInterval = 5 * time.Minute
+
+// maxMetadataBytes limits how much of an OpenID metadata or JWKs response is read.
+const maxMetadataBytes = 1 << 20
+
+type metadata struct {
+	JwksURI string `json:"jwks_uri"`
+}
+
+// getKeys returns the JWKs referenced by the OpenID metadata document, from the KeyCache if possible.
+func (jv *JwtTokenValidator) getKeys(ctx context.Context, metadataURL string) (jwk.Set, error) {
+	keys, err := jv.KeyCache.Get(ctx, "keys "+metadataURL, jv.fetchKeys(metadataURL))
+	if err != nil {
+		return nil, err
+	}
+	return keys.(jwk.Set), nil
+}
+
+// refreshKeys fetches the OpenID metadata document and JWKs again, unless they were refreshed less than
+// keyRefreshInterval ago, and replaces the cached ones once both were fetched. Returns the JWKs fetched,
+// or nil if the refresh was skipped.
+func (jv *JwtTokenValidator) refreshKeys(ctx context.Context, metadataURL string) (jwk.Set, error) {
+	now := time.Now()
+	jv.mu.Lock()
+	if now.Sub(jv.refreshedAt[metadataURL]) < keyRefreshInterval {
+		jv.mu.Unlock()
+		return nil, nil
+	}
+	if jv.refreshedAt == nil {
+		jv.refreshedAt = map[string]time.Time{}
+	}
+	jv.refreshedAt[metadataURL] = now
+	jv.mu.Unlock()
+
+	jwksURI, metadataExpiry, err := jv.fetchMetadata(metadataURL)(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, keysExpiry, err := jv.fetchJWKs(ctx, jwksURI.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	jv.KeyCache.Invalidate("metadata " + metadataURL)
+	if _, err := jv.KeyCache.Get(ctx, "metadata "+metadataURL, fetched(jwksURI, metadataExpiry)); err != nil {
+		return nil, err
+	}
+	jv.KeyCache.Invalidate("keys " + metadataURL)
+	if _, err := jv.KeyCache.Get(ctx, "keys "+metadataURL, fetched(keys, keysExpiry)); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// fetched returns a cache.FetchFunc returning a value already fetched.
+func fetched(value interface{}, expiry time.Time) cache.FetchFunc {
+	return func(ctx context.Context) (interface{}, time.Time, error) {
+		return value, expiry, nil
+	}
+}
+
+// fetchKeys returns a cache.FetchFunc getting the JWKs referenced by the OpenID metadata document.
+func (jv *JwtTokenValidator) fetchKeys(metadataURL string) cache.FetchFunc {
+	return func(ctx context.Context) (interface{}, time.Time, error) {
+		jwksURI, err := jv.KeyCache.Get(ctx, "metadata "+metadataURL, jv.fetchMetadata(metadataURL))
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		return jv.fetchJWKs(ctx, jwksURI.(string))
+	}
+}
+
+// fetchJWKs gets the JWKs at the URI and returns them with the time until which they may be cached.
+func (jv *JwtTokenValidator) fetchJWKs(ctx context.Context, jwksURI string) (jwk.Set, time.Time, error) {
+	body, expiry, err := jv.fetch(ctx, jwksURI)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	set, err := jwk.Parse(body)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("Invalid JWKs at %s: %s", jwksURI, err)
+	}
+	return set, expiry, nil
+}
+
+// fetchMetadata returns a cache.FetchFunc getting the JWKs URI of the OpenID metadata document.
+func (jv *JwtTokenValidator) fetchMetadata(metadataURL string) cache.FetchFunc {
+	return func(ctx context.Context) (interface{}, time.Time, error) {
+		body, expiry, err := jv.fetch(ctx, metadataURL)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		data := metadata{}
+		if err := json.Unmarshal(body, &data); err != nil || data.JwksURI == "" {
+			return nil, time.Time{}, fmt.Errorf("Invalid metadata document at %s", metadataURL)
+		}
+		return data.JwksURI, expiry, nil
+	}
+}
+
+// fetch gets the document at the URL and returns it with the time until which it may be cached.
+func (jv *JwtTokenValidator) fetch(ctx context.Context, url string) ([]byte, time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	client := jv.HTTPClient
+	if client == nil {
+		client = httpClient
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("Error getting %s: %s", url, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, time.Time{}, fmt.Errorf("Error getting %s: %s", url, response.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxMetadataBytes))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("Error getting %s: %s", url, err)
+	}
+	now := time.Now()
+	return body, now.Add(cacheLifetime(response.Header, now)), nil
+}
+
+// cacheLifetime returns how long a response may be cached according to its Cache-Control or Expires
+// header, within the bounds for OpenID metadata documents and JWKs.
+func cacheLifetime(header http.Header, now time.Time) time.Duration {
+	lifetime := defaultMetadataExpiry
+	if maxAge, ok := cacheControlMaxAge(header.Get("Cache-Control")); ok {
+		lifetime = maxAge
+	} else if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		lifetime = expires.Sub(now)
+	}
+
+	if lifetime < minMetadataExpiry {
+		return minMetadataExpiry
+	}
+	if lifetime > maxMetadataExpiry {
+		return maxMetadataExpiry
+	}
+	return lifetime
+}
+
+// cacheControlMaxAge returns the max-age of the Cache-Control header, or zero if the response may not be stored.
+func cacheControlMaxAge(cacheControl string) (time.Duration, bool) {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store" || directive == "no-cache":
+			return 0, true
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(directive, "max-age="), `"`))
+			if err == nil {
+				return time.Duration(seconds) * time.Second, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/schema"
+	"github.com/infracloudio/msbotbuilder-go/schema/customerror"
+	"github.com/pkg/errors"
+)
+
+// TokenRequest describes the token requested from a TokenSource.
+type TokenRequest struct {
+	// Tenant is the tenant issuing the token, like DefaultChannelAuthTenant or the tenant of a
+	// single-tenant bot.
+	Tenant string
+	// Scope is the OAuth scope of the token, like ToChannelFromBotOauthScope.
+	Scope string
+}
+
+// Token is a bearer token obtained from a TokenSource.
+type Token struct {
+	AccessToken string
+	ExpiresOn   time.Time
+}
+
+// TokenSource provides the bearer tokens used to authenticate calls to the connector service.
+type TokenSource interface {
+	Token(ctx context.Context, req TokenRequest) (Token, error)
+}
+
+// ClientCredentialsTokenSource is a TokenSource requesting tokens with the client credentials grant
+// from the token endpoint of the tenant at LoginEndpoint.
+//
+// The Credentials authenticate with a client assertion if they implement ClientAssertionProvider,
+// like CertificateCredentialProvider, or with the app password otherwise.
+type ClientCredentialsTokenSource struct {
+	Credentials CredentialProvider
+	// LoginEndpoint is the login URL prefix, ToChannelFromBotLoginURLPrefix by default.
+	LoginEndpoint string
+	HTTPClient    *http.Client
+}
+
+// NewClientSecretTokenSource returns a ClientCredentialsTokenSource authenticating with the app ID and secret.
+func NewClientSecretTokenSource(appID string, secret string) *ClientCredentialsTokenSource {
+	return &ClientCredentialsTokenSource{
+		Credentials: SimpleCredentialProvider{AppID: appID, Password: secret},
+	}
+}
+
+// NewCertificateTokenSource returns a ClientCredentialsTokenSource authenticating with the certificate.
+func NewCertificateTokenSource(credentials *CertificateCredentialProvider) *ClientCredentialsTokenSource {
+	return &ClientCredentialsTokenSource{
+		Credentials: credentials,
+	}
+}
+
+// Token implements TokenSource.
+func (ts *ClientCredentialsTokenSource) Token(ctx context.Context, req TokenRequest) (Token, error) {
+	tokenURL := ToChannelFromBotTokenURL(loginEndpoint(ts.LoginEndpoint), tenant(req.Tenant))
+	return ClientCredentialsToken(ctx, ts.HTTPClient, tokenURL, ts.Credentials, req.Scope)
+}
+
+// ClientCredentialsToken requests a token for the scope from the token endpoint at tokenURL with the
+// client credentials grant, authenticating as ClientCredentialsTokenSource does.
+func ClientCredentialsToken(ctx context.Context, httpClient *http.Client, tokenURL string, credentials CredentialProvider, scope string) (Token, error) {
+	if credentials == nil {
+		return Token{}, errors.New("Missing credentials to request a token")
+	}
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+	data.Set("client_id", credentials.GetAppID())
+	data.Set("scope", scope)
+	if assertionProvider, ok := credentials.(ClientAssertionProvider); ok {
+		assertion, err := assertionProvider.ClientAssertion(tokenURL)
+		if err != nil {
+			return Token{}, err
+		}
+		data.Set("client_assertion_type", ClientAssertionType)
+		data.Set("client_assertion", assertion)
+	} else {
+		data.Set("client_secret", credentials.GetAppPassword())
+	}
+
+	return postTokenForm(ctx, httpClient, tokenURL, data)
+}
+
+// postTokenForm posts the form to the token endpoint at tokenURL and returns the token received.
+func postTokenForm(ctx context.Context, httpClient *http.Client, tokenURL string, data url.Values) (Token, error) {
+	body := data.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(body))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return requestToken(httpClient, req)
+}
+
+// tokenResponse is the response of a token endpoint. Some endpoints, like IMDS, encode the numbers as strings.
+type tokenResponse struct {
+	AccessToken string          `json:"access_token"`
+	ExpiresIn   json.RawMessage `json:"expires_in"`
+	ExpiresOn   json.RawMessage `json:"expires_on"`
+}
+
+// oauthErrorResponse is the error response of a token endpoint.
+type oauthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// maxTokenResponseBytes limits how much of a token endpoint response is read.
+const maxTokenResponseBytes = 1 << 20
+
+// requestToken sends the request to a token endpoint and returns the token received, using the package
+// HTTP client with a timeout if tokenClient is nil.
+func requestToken(tokenClient *http.Client, req *http.Request) (Token, error) {
+	if tokenClient == nil {
+		tokenClient = httpClient
+	}
+	resp, err := tokenClient.Do(req)
+	if err != nil {
+		return Token{}, customerror.HTTPError{HtErr: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTokenResponseBytes))
+	if err != nil {
+		return Token{}, customerror.HTTPError{HtErr: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errResp *schema.ErrorResponse
+		oauthErr := oauthErrorResponse{}
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Error != "" {
+			errResp = &schema.ErrorResponse{Error: schema.Error{Code: oauthErr.Error, Message: oauthErr.ErrorDescription}}
+		}
+		return Token{}, customerror.NewHTTPErrorFromResponse(resp, errResp)
+	}
+
+	tr := tokenResponse{}
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&tr); err != nil {
+		return Token{}, errors.Wrap(err, "Invalid token response.")
+	}
+	if tr.AccessToken == "" {
+		return Token{}, errors.New("Invalid token response, missing access token")
+	}
+
+	token := Token{AccessToken: tr.AccessToken}
+	if expiresOn, err := parseSeconds(tr.ExpiresOn); err == nil {
+		token.ExpiresOn = time.Unix(expiresOn, 0)
+	} else if expiresIn, err := parseSeconds(tr.ExpiresIn); err == nil {
+		token.ExpiresOn = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	} else {
+		return Token{}, errors.New("Invalid token response, missing expiry")
+	}
+	return token, nil
+}
+
+// parseSeconds parses a JSON number of seconds, which may be encoded as a string.
+func parseSeconds(raw json.RawMessage) (int64, error) {
+	return strconv.ParseInt(strings.Trim(string(raw), `"`), 10, 64)
+}
+
+func loginEndpoint(endpoint string) string {
+	if endpoint == "" {
+		return ToChannelFromBotLoginURLPrefix
+	}
+	return endpoint
+}
+
+func tenant(tenant string) string {
+	if tenant == "" {
+		return DefaultChannelAuthTenant
+	}
+	return tenant
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package auth_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/connector/auth"
+	"github.com/infracloudio/msbotbuilder-go/schema/customerror"
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTokenServer returns a stub token server checking the requests with check.
+func newTokenServer(t *testing.T, check func(r *http.Request)) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/contoso.com/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method, "Expect POST request")
+		assert.Nil(t, r.ParseForm(), "Expect form body")
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"), "Expect client credentials grant")
+		assert.Equal(t, "https://api.botframework.com/.default", r.PostForm.Get("scope"), "Expect scope")
+		check(r)
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":3600,"access_token":"abc123"}`))
+	})
+	mux.HandleFunc("/metadata/identity/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method, "Expect GET request")
+		assert.Equal(t, "true", r.Header.Get("Metadata"), "Expect Metadata header")
+		assert.Equal(t, "https://api.botframework.com", r.URL.Query().Get("resource"), "Expect resource")
+		check(r)
+		expiresOn := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":"3600","expires_on":"` + expiresOn + `","access_token":"abc123"}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTokenSources(t *testing.T) {
+	certificate, err := auth.NewCertificateCredentialProviderFromPEM("app-id", newCertificatePEM(t))
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("federated-token\n"), 0600))
+
+	tests := []struct {
+		name   string
+		source func(srv *httptest.Server) auth.TokenSource
+		check  func(r *http.Request)
+	}{
+		{
+			name: "client secret",
+			source: func(srv *httptest.Server) auth.TokenSource {
+				ts := auth.NewClientSecretTokenSource("app-id", "secret")
+				ts.LoginEndpoint = srv.URL
+				return ts
+			},
+			check: func(r *http.Request) {
+				assert.Equal(t, "app-id", r.PostForm.Get("client_id"), "Expect client ID")
+				assert.Equal(t, "secret", r.PostForm.Get("client_secret"), "Expect client secret")
+			},
+		},
+		{
+			name: "certificate",
+			source: func(srv *httptest.Server) auth.TokenSource {
+				ts := auth.NewCertificateTokenSource(certificate)
+				ts.LoginEndpoint = srv.URL
+				return ts
+			},
+			check: func(r *http.Request) {
+				assert.Equal(t, "app-id", r.PostForm.Get("client_id"), "Expect client ID")
+				assert.Equal(t, auth.ClientAssertionType, r.PostForm.Get("client_assertion_type"), "Expect client assertion")
+				assert.NotEmpty(t, r.PostForm.Get("client_assertion"), "Expect client assertion")
+				assert.Empty(t, r.PostForm.Get("client_secret"), "Expect no client secret")
+			},
+		},
+		{
+			name: "managed identity",
+			source: func(srv *httptest.Server) auth.TokenSource {
+				ts := auth.NewManagedIdentityTokenSource("identity-id")
+				ts.Endpoint = srv.URL + "/metadata/identity/oauth2/token"
+				return ts
+			},
+			check: func(r *http.Request) {
+				assert.Equal(t, "identity-id", r.URL.Query().Get("client_id"), "Expect client ID")
+			},
+		},
+		{
+			name: "federated token file",
+			source: func(srv *httptest.Server) auth.TokenSource {
+				ts := auth.NewFederatedTokenSource("app-id", tokenFile)
+				ts.LoginEndpoint = srv.URL + "/"
+				return ts
+			},
+			check: func(r *http.Request) {
+				assert.Equal(t, "app-id", r.PostForm.Get("client_id"), "Expect client ID")
+				assert.Equal(t, auth.ClientAssertionType, r.PostForm.Get("client_assertion_type"), "Expect client assertion")
+				assert.Equal(t, "federated-token", r.PostForm.Get("client_assertion"), "Expect federated token")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := newTokenServer(t, test.check)
+			token, err := test.source(srv).Token(context.Background(), auth.TokenRequest{
+				Tenant: "contoso.com",
+				Scope:  auth.ToChannelFromBotOauthScope,
+			})
+			assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+			assert.Equal(t, "abc123", token.AccessToken, "Expect access token")
+			assert.WithinDuration(t, time.Now().Add(time.Hour), token.ExpiresOn, time.Minute, "Expect token expiry")
+		})
+	}
+}
+
+func TestTokenSourceError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"Invalid client secret provided."}`))
+	}))
+	defer srv.Close()
+
+	ts := auth.NewClientSecretTokenSource("app-id", "wrong")
+	ts.LoginEndpoint = srv.URL
+	_, err := ts.Token(context.Background(), auth.TokenRequest{Scope: auth.ToChannelFromBotOauthScope})
+
+	httpErr := customerror.HTTPError{}
+	assert.True(t, errors.As(err, &httpErr), "Expect HTTPError")
+	assert.Equal(t, http.StatusUnauthorized, httpErr.StatusCode, "Expect status code")
+	assert.Equal(t, "invalid_client", httpErr.ErrorResponse.Error.Code, "Expect OAuth error code")
+}
+
+func TestTokenSourceMissingCredentials(t *testing.T) {
+	ts := &auth.ClientCredentialsTokenSource{LoginEndpoint: "http://localhost"}
+	_, err := ts.Token(context.Background(), auth.TokenRequest{Scope: auth.ToChannelFromBotOauthScope})
+	assert.NotNil(t, err, "Expect error without credentials")
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package auth
+
+import "time"
+
+// ValidationPolicy configures the validation of the tokens received by a JwtTokenValidator.
+type ValidationPolicy struct {
+	// ClockSkew is the tolerated difference with the clock of the issuer when checking the expiry
+	// and not before time of a token.
+	ClockSkew time.Duration
+	// Audiences are accepted in addition to the app ID of the credentials.
+	Audiences []string
+	// Issuers, if set, replace the issuers of tokens from channels of the ChannelEnvironment.
+	Issuers []string
+	// Algorithms are the signing algorithms allowed, AllowedSigningAlgorithms if empty.
+	Algorithms []string
+}
+
+// DefaultClockSkew is the clock skew tolerated by DefaultValidationPolicy.
+const DefaultClockSkew = 5 * time.Minute
+
+// DefaultValidationPolicy returns the ValidationPolicy used unless configured otherwise.
+func DefaultValidationPolicy() ValidationPolicy {
+	return ValidationPolicy{
+		ClockSkew:  DefaultClockSkew,
+		Algorithms: AllowedSigningAlgorithms,
+	}
+}
+
+// algorithms returns the allowed signing algorithms.
+func (vp ValidationPolicy) algorithms() []string {
+	if len(vp.Algorithms) == 0 {
+		return AllowedSigningAlgorithms
+	}
+	return vp.Algorithms
+}
+
+// isValidIssuer checks if the issuer of a token from a channel of the environment is valid.
+func (vp ValidationPolicy) isValidIssuer(issuer string, environment ChannelEnvironment) bool {
+	if len(vp.Issuers) > 0 {
+		return contains(vp.Issuers, issuer)
+	}
+	return environment.IsValidIssuer(issuer)
+}
+
+// isValidAudience checks if one of the audiences of a token is the app ID of the credentials or one of the Audiences.
+func (vp ValidationPolicy) isValidAudience(audiences []string, credentials CredentialProvider) bool {
+	for _, audience := range audiences {
+		if credentials.IsValidAppID(audience) || contains(vp.Audiences, audience) {
+			return true
+		}
+	}
+	return false
+}
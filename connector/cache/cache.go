@@ -19,7 +19,22 @@
 
 package cache
 
-import "time"
+import (
+	"context"
+	"time"
+)
+
+// FetchFunc fetches the current value of a cache entry and returns it with its expiry time.
+type FetchFunc func(ctx context.Context) (interface{}, time.Time, error)
+
+// Cache is a concurrency safe cache of values which expire, like tokens and keys.
+type Cache interface {
+	// Get returns the cached value of key, calling fetch to obtain it if none is cached or the cached
+	// value has expired.
+	Get(ctx context.Context, key string, fetch FetchFunc) (interface{}, error)
+	// Invalidate drops the cached value of key, if any.
+	Invalidate(key string)
+}
 
 // AuthCache is a general purpose cache
 type AuthCache struct {
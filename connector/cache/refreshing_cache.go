@@ -0,0 +1,181 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RefreshingCache is the default implementation of Cache.
+//
+// Concurrent calls to Get for a key without a valid value share a single call to fetch. A value is
+// refreshed in the background once it is due to expire within RefreshBefore, so that callers keep
+// getting the cached value meanwhile. Errors returned by fetch are not cached.
+//
+// A fetch taking longer than FetchTimeout, DefaultFetchTimeout if zero, fails with
+// context.DeadlineExceeded, so that the next call to Get starts a new one.
+type RefreshingCache struct {
+	// RefreshBefore is how long before its expiry a value is refreshed.
+	RefreshBefore time.Duration
+	// FetchTimeout bounds the duration of a fetch.
+	FetchTimeout time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	value  interface{}
+	expiry time.Time
+	// fetching is set while a call to fetch is in flight
+	fetching *fetchCall
+}
+
+type fetchCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// DefaultFetchTimeout is the FetchTimeout of a RefreshingCache which does not set one.
+const DefaultFetchTimeout = time.Minute
+
+type fetchResult struct {
+	value  interface{}
+	expiry time.Time
+	err    error
+}
+
+// NewRefreshingCache returns an empty RefreshingCache which refreshes values refreshBefore their expiry.
+func NewRefreshingCache(refreshBefore time.Duration) *RefreshingCache {
+	return &RefreshingCache{
+		RefreshBefore: refreshBefore,
+		entries:       map[string]*entry{},
+	}
+}
+
+// Get implements Cache.
+//
+// The fetch is not cancelled if ctx is done, as other callers may be waiting for it, but Get returns
+// the error of ctx without waiting any further.
+func (rc *RefreshingCache) Get(ctx context.Context, key string, fetch FetchFunc) (interface{}, error) {
+	now := time.Now()
+	rc.mu.Lock()
+	if rc.entries == nil {
+		rc.entries = map[string]*entry{}
+	}
+	e, ok := rc.entries[key]
+	if !ok {
+		e = &entry{}
+		rc.entries[key] = e
+	}
+
+	if e.value != nil && now.Before(e.expiry) {
+		value := e.value
+		if e.fetching == nil && !now.Before(e.expiry.Add(-rc.RefreshBefore)) {
+			rc.startFetch(ctx, e, fetch)
+		}
+		rc.mu.Unlock()
+		return value, nil
+	}
+
+	call := e.fetching
+	if call == nil {
+		call = rc.startFetch(ctx, e, fetch)
+	}
+	rc.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Invalidate implements Cache.
+//
+// A fetch in flight is not affected and its value is cached once received.
+func (rc *RefreshingCache) Invalidate(key string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if e, ok := rc.entries[key]; ok {
+		e.value = nil
+		e.expiry = time.Time{}
+	}
+}
+
+// startFetch calls fetch in a new goroutine and caches its value once received, unless the fetch
+// times out. rc.mu must be held.
+func (rc *RefreshingCache) startFetch(ctx context.Context, e *entry, fetch FetchFunc) *fetchCall {
+	call := &fetchCall{done: make(chan struct{})}
+	e.fetching = call
+
+	timeout := rc.FetchTimeout
+	if timeout <= 0 {
+		timeout = DefaultFetchTimeout
+	}
+	fetchCtx, cancel := context.WithTimeout(detachedContext{ctx}, timeout)
+
+	go func() {
+		defer cancel()
+		// The result of a fetch ignoring fetchCtx is dropped once it is done
+		results := make(chan fetchResult, 1)
+		go func() {
+			value, expiry, err := fetch(fetchCtx)
+			results <- fetchResult{value, expiry, err}
+		}()
+		var result fetchResult
+		select {
+		case result = <-results:
+		case <-fetchCtx.Done():
+			result.err = fetchCtx.Err()
+		}
+
+		rc.mu.Lock()
+		e.fetching = nil
+		if result.err == nil {
+			e.value = result.value
+			e.expiry = result.expiry
+		}
+		rc.mu.Unlock()
+
+		call.value, call.err = result.value, result.err
+		close(call.done)
+	}()
+	return call
+}
+
+// detachedContext keeps the values of a context but is never cancelled, so that a fetch shared by
+// several callers is not aborted when the one which started it gives up. The fetch is bounded by
+// the FetchTimeout instead.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (dc detachedContext) Value(key interface{}) interface{} {
+	return dc.parent.Value(key)
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/connector/cache"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// counter returns a FetchFunc returning the number of calls made so far, valid for ttl.
+func counter(calls *int32, ttl time.Duration, delay time.Duration) cache.FetchFunc {
+	return func(ctx context.Context) (interface{}, time.Time, error) {
+		time.Sleep(delay)
+		return int(atomic.AddInt32(calls, 1)), time.Now().Add(ttl), nil
+	}
+}
+
+func TestRefreshingCacheSingleFetch(t *testing.T) {
+	rc := cache.NewRefreshingCache(0)
+	var calls int32
+	fetch := counter(&calls, time.Hour, 20*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := rc.Get(context.Background(), "token", fetch)
+			assert.Nil(t, err, "Expect no error")
+			assert.Equal(t, 1, value, "Expect value of the single fetch")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "Expect concurrent calls to share a fetch")
+
+	value, err := rc.Get(context.Background(), "other", fetch)
+	assert.Nil(t, err, "Expect no error")
+	assert.Equal(t, 2, value, "Expect keys to be cached separately")
+}
+
+func TestRefreshingCacheExpiry(t *testing.T) {
+	rc := cache.NewRefreshingCache(0)
+	var calls int32
+	fetch := counter(&calls, 10*time.Millisecond, 0)
+
+	value, _ := rc.Get(context.Background(), "token", fetch)
+	assert.Equal(t, 1, value, "Expect fetched value")
+	value, _ = rc.Get(context.Background(), "token", fetch)
+	assert.Equal(t, 1, value, "Expect cached value")
+
+	time.Sleep(20 * time.Millisecond)
+	value, _ = rc.Get(context.Background(), "token", fetch)
+	assert.Equal(t, 2, value, "Expect expired value to be fetched again")
+
+	rc.Invalidate("token")
+	value, _ = rc.Get(context.Background(), "token", fetch)
+	assert.Equal(t, 3, value, "Expect invalidated value to be fetched again")
+}
+
+func TestRefreshingCacheProactiveRefresh(t *testing.T) {
+	rc := cache.NewRefreshingCache(time.Hour)
+	var calls int32
+	fetch := counter(&calls, 30*time.Minute, 0)
+
+	value, _ := rc.Get(context.Background(), "token", fetch)
+	assert.Equal(t, 1, value, "Expect fetched value")
+	// The value expires within RefreshBefore
+	value, _ = rc.Get(context.Background(), "token", fetch)
+	assert.Equal(t, 1, value, "Expect cached value while refreshing")
+
+	assert.Eventually(t, func() bool {
+		value, _ := rc.Get(context.Background(), "token", fetch)
+		return value.(int) > 1
+	}, time.Second, time.Millisecond, "Expect value to be refreshed in the background")
+}
+
+func TestRefreshingCacheErrors(t *testing.T) {
+	rc := cache.NewRefreshingCache(0)
+	fetchErr := errors.New("unavailable")
+	_, err := rc.Get(context.Background(), "token", func(ctx context.Context) (interface{}, time.Time, error) {
+		return nil, time.Time{}, fetchErr
+	})
+	assert.Equal(t, fetchErr, err, "Expect fetch error")
+
+	var calls int32
+	value, err := rc.Get(context.Background(), "token", counter(&calls, time.Hour, 0))
+	assert.Nil(t, err, "Expect errors not to be cached")
+	assert.Equal(t, 1, value, "Expect fetched value")
+}
+
+func TestRefreshingCacheContextDone(t *testing.T) {
+	rc := cache.NewRefreshingCache(0)
+	var calls int32
+	fetch := counter(&calls, time.Hour, 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := rc.Get(ctx, "token", fetch)
+	assert.Equal(t, context.Canceled, err, "Expect context error")
+
+	value, err := rc.Get(context.Background(), "token", fetch)
+	assert.Nil(t, err, "Expect fetch not to be cancelled")
+	assert.Equal(t, 1, value, "Expect value of the fetch started before")
+}
+
+func TestRefreshingCacheFetchTimeout(t *testing.T) {
+	rc := cache.NewRefreshingCache(0)
+	rc.FetchTimeout = 20 * time.Millisecond
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	_, err := rc.Get(context.Background(), "token", func(ctx context.Context) (interface{}, time.Time, error) {
+		// A fetch ignoring its context
+		<-unblock
+		return 0, time.Now().Add(time.Hour), nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err, "Expect blocked fetch to time out")
+
+	var calls int32
+	value, err := rc.Get(context.Background(), "token", counter(&calls, time.Hour, 0))
+	assert.Nil(t, err, "Expect no error")
+	assert.Equal(t, 1, value, "Expect a new fetch after the timeout")
+}
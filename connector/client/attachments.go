@@ -0,0 +1,111 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/infracloudio/msbotbuilder-go/schema"
+	"github.com/pkg/errors"
+)
+
+// Attachments provides typed access to the Attachments operations of the connector service,
+// used to download attachments hosted by the channel.
+//
+// Every operation takes the service URL of the channel, as found in the ServiceURL of a received activity.
+type Attachments interface {
+	GetAttachmentInfo(ctx context.Context, serviceURL string, attachmentID string) (schema.AttachmentInfo, error)
+	GetAttachment(ctx context.Context, serviceURL string, attachmentID string, viewID string) (io.ReadCloser, error)
+}
+
+const (
+	attachmentURL     = "/v3/attachments/%s"
+	attachmentViewURL = "/v3/attachments/%s/views/%s"
+)
+
+// AttachmentsClient is the default implementation of Attachments.
+type AttachmentsClient struct {
+	Client Client
+}
+
+// NewAttachmentsClient returns an AttachmentsClient sending its requests with the given Client.
+func NewAttachmentsClient(connectorClient Client) (Attachments, error) {
+	if connectorClient == nil {
+		return nil, errors.New("Invalid connector client for Attachments")
+	}
+	return &AttachmentsClient{connectorClient}, nil
+}
+
+// Attachments returns the Attachments operations of the connector service using this client.
+func (client *ConnectorClient) Attachments() Attachments {
+	return &AttachmentsClient{client}
+}
+
+// GetAttachmentInfo returns the name, content type and available views of an attachment.
+func (ac *AttachmentsClient) GetAttachmentInfo(ctx context.Context, serviceURL string, attachmentID string) (schema.AttachmentInfo, error) {
+	u, err := ResourceURL(serviceURL, attachmentURL, attachmentID)
+	if err != nil {
+		return schema.AttachmentInfo{}, err
+	}
+	info := schema.AttachmentInfo{}
+	err = Call(ctx, ac.Client, http.MethodGet, *u, nil, &info)
+	return info, errors.Wrap(err, "Failed to get attachment info.")
+}
+
+// GetAttachment downloads a view of an attachment, e.g. "original" or "thumbnail".
+// The Client must implement StreamClient, as ConnectorClient does.
+// The caller must close the returned content.
+func (ac *AttachmentsClient) GetAttachment(ctx context.Context, serviceURL string, attachmentID string, viewID string) (io.ReadCloser, error) {
+	u, err := ResourceURL(serviceURL, attachmentViewURL, attachmentID, viewID)
+	if err != nil {
+		return nil, err
+	}
+	streamClient, ok := ac.Client.(StreamClient)
+	if !ok {
+		return nil, errors.Errorf("%T does not implement client.StreamClient to get attachment %s", ac.Client, attachmentID)
+	}
+	content, err := streamClient.GetStream(ctx, *u)
+	return content, errors.Wrap(err, "Failed to get attachment.")
+}
+
+// ResourceURL returns the URL of a resource of the connector service at the given service URL.
+// The resource path is formatted from resourceFormat and the IDs, each escaped as a single path segment
+// since channels use IDs like "19:abc@thread.v2" or "a:1/b;messageid=2".
+func ResourceURL(serviceURL string, resourceFormat string, ids ...string) (*url.URL, error) {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse ServiceURL %s.", serviceURL)
+	}
+	segments := make([]interface{}, len(ids))
+	for i, id := range ids {
+		segments[i] = url.PathEscape(id)
+	}
+	u.RawPath = path.Join(u.EscapedPath(), fmt.Sprintf(resourceFormat, segments...))
+	u.Path, err = url.PathUnescape(u.RawPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse ServiceURL %s.", serviceURL)
+	}
+	return u, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/infracloudio/msbotbuilder-go/connector/client"
+	"github.com/infracloudio/msbotbuilder-go/schema"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttachments(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/attachments/att1", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"name":"image.png","type":"image/png","views":[{"viewId":"original","size":4}]}`))
+	})
+	mux.HandleFunc("/v3/attachments/att1/views/original", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer abc123", r.Header.Get("Authorization"), "Expect bearer token")
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("\x89PNG"))
+	})
+	connectorClient, srv := newTestClient(t, mux)
+	attachments := connectorClient.Attachments()
+	ctx := context.Background()
+
+	info, err := attachments.GetAttachmentInfo(ctx, srv.URL, "att1")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, schema.AttachmentInfo{Name: "image.png", Type: "image/png", Views: []schema.AttachmentView{{ViewID: "original", Size: 4}}}, info)
+
+	content, err := attachments.GetAttachment(ctx, srv.URL, "att1", info.Views[0].ViewID)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	data, err := ioutil.ReadAll(content)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Nil(t, content.Close())
+	assert.Equal(t, "\x89PNG", string(data))
+
+	_, err = attachments.GetAttachment(ctx, srv.URL, "att1", "thumbnail")
+	assert.NotNil(t, err, "Expect error for unknown view")
+}
+
+func TestAttachmentsWithoutStreamClient(t *testing.T) {
+	connectorClient, srv := newTestClient(t, http.NewServeMux())
+	attachments, err := client.NewAttachmentsClient(basicClient{connectorClient})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	_, err = attachments.GetAttachment(context.Background(), srv.URL, "att1", "original")
+	assert.NotNil(t, err, "Expect error from a client without GetStream")
+}
@@ -25,10 +25,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/infracloudio/msbotbuilder-go/connector/auth"
@@ -45,13 +45,60 @@ type Client interface {
 	Put(ctx context.Context, url url.URL, activity schema.Activity) error
 }
 
+// StreamClient is implemented by clients, like ConnectorClient, which can return the body of a response unread,
+// e.g. to download an attachment. Attachments can only be downloaded with clients implementing it.
+type StreamClient interface {
+	GetStream(ctx context.Context, url url.URL) (io.ReadCloser, error)
+}
+
+// Caller is implemented by clients, like ConnectorClient, which can send any request to the connector service
+// and decode its response. Clients which do not implement it are limited by Call to the methods of Client.
+type Caller interface {
+	Call(ctx context.Context, method string, url url.URL, body interface{}, result interface{}) error
+}
+
+// Call sends a request with the given method to the connector service using the Call method of the client,
+// if it implements Caller.
+//
+// Otherwise the request is sent with the matching method of Client: only activities can be posted or put,
+// and their responses are not decoded.
+func Call(ctx context.Context, c Client, method string, target url.URL, body interface{}, result interface{}) error {
+	if caller, ok := c.(Caller); ok {
+		return caller.Call(ctx, method, target, body, result)
+	}
+
+	activity, isActivity := body.(schema.Activity)
+	switch {
+	case method == http.MethodGet && body == nil:
+		raw, err := c.Get(ctx, target)
+		if err != nil || result == nil {
+			return err
+		}
+		return json.Unmarshal(raw, result)
+	case method == http.MethodDelete && body == nil:
+		return c.Delete(ctx, target)
+	case method == http.MethodPost && isActivity:
+		return c.Post(ctx, target, activity)
+	case method == http.MethodPut && isActivity:
+		return c.Put(ctx, target, activity)
+	}
+	return fmt.Errorf("%T does not implement client.Caller to send %s %s", c, method, target.Path)
+}
+
 // ConnectorClient implements Client to send HTTP requests to the connector service.
 type ConnectorClient struct {
 	Config
-	cache.AuthCache
 }
 
-// NewClient constructs and returns a new ConnectorClient with provided configuration and an empty cache.
+// tokenRefreshBefore is how long before their expiry tokens are refreshed by the default token cache.
+const tokenRefreshBefore = 5 * time.Minute
+
+// authTimeout bounds the token requests of the default AuthClient.
+const authTimeout = 20 * time.Second
+
+// NewClient constructs and returns a new ConnectorClient with provided configuration.
+// Tokens are requested from the botframework.com tenant for the Bot Framework scope unless configured
+// otherwise. A RefreshingCache is used for tokens unless the configuration has a TokenCache.
 // Returns error if Config passed is nil.
 func NewClient(config *Config) (Client, error) {
 	if config == nil {
@@ -59,14 +106,30 @@ func NewClient(config *Config) (Client, error) {
 	}
 
 	if config.AuthClient == nil {
-		config.AuthClient = &http.Client{}
+		config.AuthClient = &http.Client{Timeout: authTimeout}
 	}
 
 	if config.ReplyClient == nil {
 		config.ReplyClient = &http.Client{}
 	}
 
-	return &ConnectorClient{*config, cache.AuthCache{}}, nil
+	if config.ChannelAuthTenant == "" {
+		config.ChannelAuthTenant = auth.DefaultChannelAuthTenant
+	}
+
+	if config.OAuthEndpoint == "" {
+		config.OAuthEndpoint = auth.ToChannelFromBotLoginURLPrefix
+	}
+
+	if config.OAuthScope == "" {
+		config.OAuthScope = auth.ToChannelFromBotOauthScope
+	}
+
+	if config.TokenCache == nil {
+		config.TokenCache = cache.NewRefreshingCache(tokenRefreshBefore)
+	}
+
+	return &ConnectorClient{*config}, nil
 }
 
 // Post an activity to given URL.
@@ -74,15 +137,7 @@ func NewClient(config *Config) (Client, error) {
 // Creates a HTTP POST request with the provided activity as the body and a Bearer token in the header.
 // Returns any error as received from the call to connector service.
 func (client *ConnectorClient) Post(ctx context.Context, target url.URL, activity schema.Activity) error {
-	jsonStr, err := json.Marshal(activity)
-	if err != nil {
-		return err
-	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewBuffer(jsonStr))
-	if err != nil {
-		return err
-	}
-	return client.sendRequestWithRespErrCheck(req)
+	return client.Call(ctx, http.MethodPost, target, activity, nil)
 }
 
 // Get a resource from given URL using authenticated request.
@@ -114,6 +169,28 @@ func (client *ConnectorClient) Get(ctx context.Context, target url.URL) (json.Ra
 	return rawOutput, nil
 }
 
+// GetStream gets a resource from given URL using authenticated request and returns its body unread.
+//
+// This method is helpful for downloading attachments hosted by the channel. The caller must close
+// the returned body.
+func (client *ConnectorClient) GetStream(ctx context.Context, target url.URL) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.sendRequest(req)
+	if err != nil {
+		return nil, newHTTPError(err)
+	}
+
+	if wrappedErr := client.checkRespError(res); wrappedErr != nil {
+		res.Body.Close()
+		return nil, wrappedErr
+	}
+	return res.Body, nil
+}
+
 // Delete an activity.
 //
 // Creates a HTTP DELETE request with the provided activity ID and a Bearer token in the header.
@@ -131,15 +208,53 @@ func (client *ConnectorClient) Delete(ctx context.Context, target url.URL) error
 // Creates a HTTP PUT request with the provided activity payload and a Bearer token in the header.
 // Returns any error as received from the call to connector service.
 func (client *ConnectorClient) Put(ctx context.Context, target url.URL, activity schema.Activity) error {
-	jsonStr, err := json.Marshal(activity)
+	return client.Call(ctx, http.MethodPut, target, activity, nil)
+}
+
+// Call sends an authenticated request with the given method to the connector service.
+//
+// The body, if not nil, is sent JSON encoded. The JSON response, if any, is decoded into result
+// unless result is nil. POST and PUT requests wait for the RateLimiter, if any, before being sent.
+// Returns any error as received from the call to connector service.
+func (client *ConnectorClient) Call(ctx context.Context, method string, target url.URL, body interface{}, result interface{}) error {
+	if client.RateLimiter != nil && (method == http.MethodPost || method == http.MethodPut) {
+		if err := client.RateLimiter.Wait(ctx, rateLimitKey(target, body)); err != nil {
+			return err
+		}
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		jsonStr, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewBuffer(jsonStr)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), reqBody)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), bytes.NewBuffer(jsonStr))
+
+	res, err := client.sendRequest(req)
 	if err != nil {
-		return err
+		return newHTTPError(err)
 	}
-	return client.sendRequestWithRespErrCheck(req)
+	defer res.Body.Close()
+
+	if wrappedErr := client.checkRespError(res); wrappedErr != nil {
+		return wrappedErr
+	}
+
+	if result == nil {
+		return nil
+	}
+	// Some operations respond with an empty body
+	err = json.NewDecoder(res.Body).Decode(result)
+	if err == io.EOF {
+		return nil
+	}
+	return err
 }
 
 func (client *ConnectorClient) sendRequestWithRespErrCheck(req *http.Request) error {
@@ -152,20 +267,73 @@ func (client *ConnectorClient) sendRequestWithRespErrCheck(req *http.Request) er
 	return client.checkRespError(res)
 }
 
+// sendRequest sends the request with a Bearer token, retrying it as allowed by the RetryPolicy.
+// A request rejected with 401 Unauthorized is sent once more with a newly acquired token.
 func (client *ConnectorClient) sendRequest(req *http.Request) (*http.Response, error) {
-	token, err := client.getToken(req.Context())
-	if err != nil {
-		return nil, err
-	}
-
+	ctx := req.Context()
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
 
-	return client.ReplyClient.Do(req)
+	tokenRefreshed := false
+	for attempt := 1; ; attempt++ {
+		token, err := client.getToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := client.ReplyClient.Do(req)
+
+		var delay time.Duration
+		retry := false
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && !tokenRefreshed {
+			// The cached token may have been revoked
+			tokenRefreshed = true
+			client.TokenCache.Invalidate(client.tokenCacheKey(ctx))
+			retry = true
+			attempt--
+		} else if client.RetryPolicy != nil {
+			delay, retry = client.RetryPolicy.NextRetry(attempt, req, resp, err)
+		}
+
+		if !retry || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxErrorBodyBytes))
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+
+		// Rewind the body for the next attempt
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// sleep waits for the delay to elapse or the context to be done.
+func sleep(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
 func (client *ConnectorClient) checkRespError(resp *http.Response) error {
-	allowedResp := []int{http.StatusOK, http.StatusCreated, http.StatusAccepted}
+	allowedResp := []int{http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent}
 	// Check if resp allowed
 	for _, code := range allowedResp {
 		if code == resp.StatusCode {
@@ -173,56 +341,56 @@ func (client *ConnectorClient) checkRespError(resp *http.Response) error {
 		}
 	}
 
-	return newHTTPErrorWithStatusCode(errors.New("invalid response"), resp.StatusCode)
+	return newHTTPErrorFromResponse(resp)
 }
 
-func (client *ConnectorClient) getToken(ctx context.Context) (string, error) {
-
-	// Return cached JWT
-	if !client.AuthCache.IsExpired() {
-		return client.AuthCache.Keys.(string), nil
+// tokenCacheKey identifies the token for calls made with ctx in the TokenCache, which may be shared
+// by clients with different credentials.
+func (client *ConnectorClient) tokenCacheKey(ctx context.Context) string {
+	tenant, scope := client.tokenRequest(ctx)
+	appID := ""
+	if client.Credentials != nil {
+		appID = client.Credentials.GetAppID()
 	}
+	return appID + " " + tenant + " " + scope
+}
 
-	// Get new JWT
-	data := url.Values{}
-	data.Set("grant_type", "client_credentials")
-	data.Set("client_id", client.Credentials.GetAppID())
-	data.Set("client_secret", client.Credentials.GetAppPassword())
-	data.Set("scope", auth.ToChannelFromBotOauthScope)
-
-	u, err := url.ParseRequestURI(client.AuthURL.String())
+// getToken returns a token for the tenant and scope of calls made with ctx.
+func (client *ConnectorClient) getToken(ctx context.Context) (string, error) {
+	tenant, scope := client.tokenRequest(ctx)
+	token, err := client.TokenCache.Get(ctx, client.tokenCacheKey(ctx), func(ctx context.Context) (interface{}, time.Time, error) {
+		return client.fetchToken(ctx, tenant, scope)
+	})
 	if err != nil {
 		return "", err
 	}
+	return token.(string), nil
+}
 
-	r, err := http.NewRequestWithContext(ctx, "POST", u.String(), strings.NewReader(data.Encode()))
-	if err != nil {
-		return "", err
+// tokenURL returns the URL of the token endpoint of the tenant. The AuthURL is used for the
+// ChannelAuthTenant, if set.
+func (client *ConnectorClient) tokenURL(tenant string) string {
+	if tenant == client.ChannelAuthTenant && client.AuthURL.String() != "" {
+		return client.AuthURL.String()
 	}
+	return auth.ToChannelFromBotTokenURL(client.OAuthEndpoint, tenant)
+}
 
-	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	r.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
-
-	resp, err := client.AuthClient.Do(r)
-	if err != nil {
-		return "", newHTTPErrorWithStatusCode(err, resp.StatusCode)
+// fetchToken gets a new JWT for the tenant and scope from the TokenSource, or with the client credentials
+// grant using the Credentials if there is none.
+func (client *ConnectorClient) fetchToken(ctx context.Context, tenant string, scope string) (interface{}, time.Time, error) {
+	req := auth.TokenRequest{Tenant: tenant, Scope: scope}
+	var token auth.Token
+	var err error
+	if client.TokenSource != nil {
+		token, err = client.TokenSource.Token(ctx, req)
+	} else {
+		token, err = auth.ClientCredentialsToken(ctx, client.AuthClient, client.tokenURL(tenant), client.Credentials, scope)
 	}
-
-	defer resp.Body.Close()
-
-	a := &schema.AuthResponse{}
-	err = json.NewDecoder(resp.Body).Decode(a)
 	if err != nil {
-		return "", fmt.Errorf("Invalid activity to send %s", err)
-	}
-
-	// Update cache
-	client.AuthCache = cache.AuthCache{
-		Keys:   a.AccessToken,
-		Expiry: time.Now().Add(time.Second * time.Duration(a.ExpireTime)),
+		return nil, time.Time{}, err
 	}
-
-	return client.AuthCache.Keys.(string), nil
+	return token.AccessToken, token.ExpiresOn, nil
 }
 
 func newHTTPError(err error) error {
@@ -231,9 +399,19 @@ func newHTTPError(err error) error {
 	}
 }
 
-func newHTTPErrorWithStatusCode(err error, statusCode int) error {
-	return customerror.HTTPError{
-		HtErr:      err,
-		StatusCode: statusCode,
+// maxErrorBodyBytes limits how much of an error response body is read.
+const maxErrorBodyBytes = 64 << 10
+
+// newHTTPErrorFromResponse returns an error describing the failed response, including the
+// error reported by the connector service in the response body, if any.
+func newHTTPErrorFromResponse(resp *http.Response) error {
+	var errResp *schema.ErrorResponse
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	if err == nil && len(body) > 0 {
+		decoded := schema.ErrorResponse{}
+		if json.Unmarshal(body, &decoded) == nil {
+			errResp = &decoded
+		}
 	}
+	return customerror.NewHTTPErrorFromResponse(resp, errResp)
 }
@@ -22,16 +22,33 @@ package client
 import (
 	"errors"
 	"github.com/infracloudio/msbotbuilder-go/connector/auth"
+	"github.com/infracloudio/msbotbuilder-go/connector/cache"
 	"net/http"
 	"net/url"
 )
 
 // Config represents the credentials for a user program and the URL for validating the credentials.
+//
+// Tokens are requested for OAuthScope from the ChannelAuthTenant using AuthURL. Tokens for other
+// tenants, see WithTenant, are requested from the token endpoint of the tenant at OAuthEndpoint,
+// the login URL prefix like https://login.microsoftonline.com/.
+//
+// RetryPolicy, if set, decides which failed requests to the connector service are retried.
+// RateLimiter, if set, delays activities sent to the connector service.
+// TokenSource, if set, provides the tokens instead of requesting them with the Credentials.
+// TokenCache, if set, caches the tokens obtained.
 type Config struct {
-	Credentials auth.CredentialProvider
-	AuthURL     url.URL
-	AuthClient  *http.Client
-	ReplyClient *http.Client
+	Credentials       auth.CredentialProvider
+	AuthURL           url.URL
+	ChannelAuthTenant string
+	OAuthEndpoint     string
+	OAuthScope        string
+	AuthClient        *http.Client
+	ReplyClient       *http.Client
+	RetryPolicy       RetryPolicy
+	RateLimiter       RateLimiter
+	TokenSource       auth.TokenSource
+	TokenCache        cache.Cache
 }
 
 // NewClientConfig creates configuration for ConnectorClient.
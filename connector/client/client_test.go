@@ -0,0 +1,215 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/connector/auth"
+	"github.com/infracloudio/msbotbuilder-go/connector/client"
+	"github.com/infracloudio/msbotbuilder-go/schema"
+	"github.com/infracloudio/msbotbuilder-go/schema/customerror"
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectorErrorResponse(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/conversations/abcd1234/activities", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		w.Header().Set("MS-CV", "cv.1")
+		w.Header().Set("x-ms-request-id", "req-1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":{"code":"Throttled","message":"Too many requests"}}`))
+	})
+	connectorClient, srv := newTestClient(t, mux)
+
+	target, err := url.Parse(srv.URL + "/v3/conversations/abcd1234/activities")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	err = connectorClient.Post(context.Background(), *target, schema.Activity{Type: schema.Message})
+	assert.NotNil(t, err, "Expect error for throttled request")
+
+	// Errors stay recognizable when wrapped
+	err = errors.Wrap(err, "Failed to send response.")
+	assert.True(t, customerror.IsThrottled(err), "Expect throttled error")
+	assert.False(t, customerror.IsNotFound(err), "Expect no not found error")
+
+	htErr := customerror.HTTPError{}
+	assert.True(t, errors.As(err, &htErr), "Expect HTTPError")
+	assert.Equal(t, http.StatusTooManyRequests, htErr.StatusCode)
+	assert.Equal(t, http.MethodPost, htErr.Method)
+	assert.Equal(t, target.String(), htErr.URL)
+	assert.Equal(t, 2*time.Second, htErr.RetryAfter)
+	assert.Equal(t, "cv.1", htErr.CorrelationVector)
+	assert.Equal(t, "req-1", htErr.CorrelationID)
+	assert.Equal(t, "Throttled", htErr.ErrorResponse.Error.Code)
+	assert.Equal(t, "Too many requests", htErr.ErrorResponse.Error.Message)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 5*time.Second, customerror.ParseRetryAfter("5", now))
+	assert.Equal(t, 30*time.Second, customerror.ParseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), customerror.ParseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), customerror.ParseRetryAfter("", now))
+}
+
+func TestConcurrentRequestsShareToken(t *testing.T) {
+	var tokenRequests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokenRequests, 1)
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":3600,"access_token":"abc123"}`))
+	})
+	mux.HandleFunc("/v3/conversations/abcd1234/activities", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer abc123", r.Header.Get("Authorization"), "Expect bearer token")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	config, err := client.NewClientConfig(auth.SimpleCredentialProvider{AppID: "asdasd", Password: "secret"}, srv.URL+"/oauth2/v2.0/token")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	connectorClient, err := client.NewClient(config)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	target, err := url.Parse(srv.URL + "/v3/conversations/abcd1234/activities")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := connectorClient.Post(context.Background(), *target, schema.Activity{Type: schema.Message})
+			assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&tokenRequests), "Expect a single token request")
+}
+
+func TestTokenPerTenantAndScope(t *testing.T) {
+	tokenRequests := map[string]int{}
+	var authorization string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/contoso.onmicrosoft.com/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, r.ParseForm(), "Expect form body")
+		scope := r.PostForm.Get("scope")
+		tokenRequests[scope]++
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"token_type":"Bearer","expires_in":3600,"access_token":"contoso %s"}`, scope)))
+	})
+	mux.HandleFunc("/v3/conversations/abcd1234/activities", func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	})
+	connectorClient, srv := newTestClient(t, mux)
+	connectorClient.OAuthEndpoint = srv.URL + "/"
+
+	target, err := url.Parse(srv.URL + "/v3/conversations/abcd1234/activities")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	tenantCtx := client.WithTenant(context.Background(), "contoso.onmicrosoft.com")
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		authorization string
+	}{
+		{"default tenant", context.Background(), "Bearer abc123"},
+		{"tenant", tenantCtx, "Bearer contoso " + auth.ToChannelFromBotOauthScope},
+		{"skill audience", client.WithAudience(tenantCtx, "skill-app-id"), "Bearer contoso skill-app-id/.default"},
+		{"cached token", tenantCtx, "Bearer contoso " + auth.ToChannelFromBotOauthScope},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := connectorClient.Post(test.ctx, *target, schema.Activity{Type: schema.Message})
+			assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+			assert.Equal(t, test.authorization, authorization, "Expect token of tenant and scope")
+		})
+	}
+	assert.Equal(t, map[string]int{auth.ToChannelFromBotOauthScope: 1, "skill-app-id/.default": 1}, tokenRequests, "Expect tokens cached per tenant and scope")
+}
+
+func TestTokenWithClientAssertion(t *testing.T) {
+	pfxData, err := ioutil.ReadFile("../auth/testdata/certificate.p12")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	credentials, err := auth.NewCertificateCredentialProviderFromPKCS12("asdasd", pfxData, "secret")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, r.ParseForm(), "Expect form body")
+		assert.Equal(t, auth.ClientAssertionType, r.PostForm.Get("client_assertion_type"), "Expect client assertion")
+		assert.NotEmpty(t, r.PostForm.Get("client_assertion"), "Expect client assertion")
+		assert.Empty(t, r.PostForm.Get("client_secret"), "Expect no client secret")
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":3600,"access_token":"abc123"}`))
+	})
+	mux.HandleFunc("/v3/conversations/abcd1234/activities", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer abc123", r.Header.Get("Authorization"), "Expect bearer token")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	config, err := client.NewClientConfig(credentials, srv.URL+"/oauth2/v2.0/token")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	connectorClient, err := client.NewClient(config)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	target, err := url.Parse(srv.URL + "/v3/conversations/abcd1234/activities")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	err = connectorClient.Post(context.Background(), *target, schema.Activity{Type: schema.Message})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+}
+
+type stubTokenSource struct {
+	requests []auth.TokenRequest
+}
+
+func (ts *stubTokenSource) Token(ctx context.Context, req auth.TokenRequest) (auth.Token, error) {
+	ts.requests = append(ts.requests, req)
+	return auth.Token{AccessToken: "from-source", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestTokenSource(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/conversations/abcd1234/activities", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer from-source", r.Header.Get("Authorization"), "Expect token of the TokenSource")
+	})
+	connectorClient, srv := newTestClient(t, mux)
+	tokenSource := &stubTokenSource{}
+	connectorClient.TokenSource = tokenSource
+
+	target, err := url.Parse(srv.URL + "/v3/conversations/abcd1234/activities")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	ctx := client.WithTenant(context.Background(), "contoso.com")
+	for i := 0; i < 2; i++ {
+		err = connectorClient.Post(ctx, *target, schema.Activity{Type: schema.Message})
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	}
+	assert.Equal(t, []auth.TokenRequest{{Tenant: "contoso.com", Scope: auth.ToChannelFromBotOauthScope}}, tokenSource.requests, "Expect a single cached token request")
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package client
+
+import (
+	"context"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	tenantKey contextKey = iota
+	oauthScopeKey
+)
+
+// WithTenant returns a context requesting the tokens of calls made with it from the given tenant,
+// instead of the ChannelAuthTenant of the client.
+//
+// Single-tenant bots use the tenant of their app registration.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// WithOAuthScope returns a context requesting the tokens of calls made with it for the given scope,
+// instead of the OAuthScope of the client.
+func WithOAuthScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, oauthScopeKey, scope)
+}
+
+// WithAudience returns a context requesting the tokens of calls made with it for the given audience,
+// like the app ID of a skill, using the scope audience + "/.default".
+func WithAudience(ctx context.Context, audience string) context.Context {
+	return WithOAuthScope(ctx, strings.TrimSuffix(audience, "/")+"/.default")
+}
+
+// tokenRequest returns the tenant and scope of the tokens for calls made with ctx.
+func (client *ConnectorClient) tokenRequest(ctx context.Context) (tenant string, scope string) {
+	tenant, _ = ctx.Value(tenantKey).(string)
+	if tenant == "" {
+		tenant = client.ChannelAuthTenant
+	}
+	scope, _ = ctx.Value(oauthScopeKey).(string)
+	if scope == "" {
+		scope = client.OAuthScope
+	}
+	return tenant, scope
+}
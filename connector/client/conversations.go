@@ -0,0 +1,185 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/infracloudio/msbotbuilder-go/schema"
+	"github.com/pkg/errors"
+)
+
+// Conversations provides typed access to the Conversations operations of the connector service.
+//
+// Every operation takes the service URL of the channel, as found in the ServiceURL of a received activity.
+type Conversations interface {
+	CreateConversation(ctx context.Context, serviceURL string, parameters schema.ConversationParameters) (schema.ConversationResourceResponse, error)
+	GetConversations(ctx context.Context, serviceURL string, continuationToken string) (schema.ConversationsResult, error)
+	SendToConversation(ctx context.Context, serviceURL string, conversationID string, activity schema.Activity) (schema.ResourceResponse, error)
+	SendConversationHistory(ctx context.Context, serviceURL string, conversationID string, history schema.Transcript) (schema.ResourceResponse, error)
+	ReplyToActivity(ctx context.Context, serviceURL string, conversationID string, activityID string, activity schema.Activity) (schema.ResourceResponse, error)
+	UpdateActivity(ctx context.Context, serviceURL string, conversationID string, activityID string, activity schema.Activity) (schema.ResourceResponse, error)
+	DeleteActivity(ctx context.Context, serviceURL string, conversationID string, activityID string) error
+	GetConversationMembers(ctx context.Context, serviceURL string, conversationID string) ([]schema.ChannelAccount, error)
+	GetConversationPagedMembers(ctx context.Context, serviceURL string, conversationID string, pageSize int, continuationToken string) (schema.PagedMembersResult, error)
+	DeleteConversationMember(ctx context.Context, serviceURL string, conversationID string, memberID string) error
+	GetActivityMembers(ctx context.Context, serviceURL string, conversationID string, activityID string) ([]schema.ChannelAccount, error)
+	UploadAttachment(ctx context.Context, serviceURL string, conversationID string, attachmentUpload schema.AttachmentData) (schema.ResourceResponse, error)
+}
+
+const (
+	conversationsURL            = "/v3/conversations"
+	conversationActivitiesURL   = "/v3/conversations/%s/activities"
+	conversationHistoryURL      = "/v3/conversations/%s/activities/history"
+	conversationActivityURL     = "/v3/conversations/%s/activities/%s"
+	activityMembersURL          = "/v3/conversations/%s/activities/%s/members"
+	conversationMembersURL      = "/v3/conversations/%s/members"
+	conversationPagedMembersURL = "/v3/conversations/%s/pagedmembers"
+	conversationMemberURL       = "/v3/conversations/%s/members/%s"
+	conversationAttachmentsURL  = "/v3/conversations/%s/attachments"
+)
+
+// ConversationsClient is the default implementation of Conversations.
+type ConversationsClient struct {
+	Client Client
+}
+
+// NewConversationsClient returns a ConversationsClient sending its requests with the given Client.
+func NewConversationsClient(connectorClient Client) (Conversations, error) {
+	if connectorClient == nil {
+		return nil, errors.New("Invalid connector client for Conversations")
+	}
+	return &ConversationsClient{connectorClient}, nil
+}
+
+// Conversations returns the Conversations operations of the connector service using this client.
+func (client *ConnectorClient) Conversations() Conversations {
+	return &ConversationsClient{client}
+}
+
+// CreateConversation creates a new conversation, e.g. to start a proactive conversation with a user.
+func (cc *ConversationsClient) CreateConversation(ctx context.Context, serviceURL string, parameters schema.ConversationParameters) (schema.ConversationResourceResponse, error) {
+	result := schema.ConversationResourceResponse{}
+	err := cc.call(ctx, http.MethodPost, serviceURL, conversationsURL, nil, nil, parameters, &result)
+	return result, errors.Wrap(err, "Failed to create conversation.")
+}
+
+// GetConversations lists the conversations the bot has participated in.
+// Pass the ContinuationToken of the previous result to get the next page, or an empty string for the first one.
+func (cc *ConversationsClient) GetConversations(ctx context.Context, serviceURL string, continuationToken string) (schema.ConversationsResult, error) {
+	query := url.Values{}
+	if continuationToken != "" {
+		query.Set("continuationToken", continuationToken)
+	}
+	result := schema.ConversationsResult{}
+	err := cc.call(ctx, http.MethodGet, serviceURL, conversationsURL, nil, query, nil, &result)
+	return result, errors.Wrap(err, "Failed to get conversations.")
+}
+
+// SendToConversation sends an activity to the end of a conversation.
+func (cc *ConversationsClient) SendToConversation(ctx context.Context, serviceURL string, conversationID string, activity schema.Activity) (schema.ResourceResponse, error) {
+	result := schema.ResourceResponse{}
+	err := cc.call(ctx, http.MethodPost, serviceURL, conversationActivitiesURL, []string{conversationID}, nil, activity, &result)
+	return result, errors.Wrap(err, "Failed to send activity.")
+}
+
+// SendConversationHistory uploads historic activities to a conversation.
+func (cc *ConversationsClient) SendConversationHistory(ctx context.Context, serviceURL string, conversationID string, history schema.Transcript) (schema.ResourceResponse, error) {
+	result := schema.ResourceResponse{}
+	err := cc.call(ctx, http.MethodPost, serviceURL, conversationHistoryURL, []string{conversationID}, nil, history, &result)
+	return result, errors.Wrap(err, "Failed to send conversation history.")
+}
+
+// ReplyToActivity sends an activity as a reply to another activity of a conversation.
+func (cc *ConversationsClient) ReplyToActivity(ctx context.Context, serviceURL string, conversationID string, activityID string, activity schema.Activity) (schema.ResourceResponse, error) {
+	result := schema.ResourceResponse{}
+	err := cc.call(ctx, http.MethodPost, serviceURL, conversationActivityURL, []string{conversationID, activityID}, nil, activity, &result)
+	return result, errors.Wrap(err, "Failed to reply to activity.")
+}
+
+// UpdateActivity replaces an existing activity of a conversation.
+func (cc *ConversationsClient) UpdateActivity(ctx context.Context, serviceURL string, conversationID string, activityID string, activity schema.Activity) (schema.ResourceResponse, error) {
+	result := schema.ResourceResponse{}
+	err := cc.call(ctx, http.MethodPut, serviceURL, conversationActivityURL, []string{conversationID, activityID}, nil, activity, &result)
+	return result, errors.Wrap(err, "Failed to update activity.")
+}
+
+// DeleteActivity deletes an existing activity of a conversation.
+func (cc *ConversationsClient) DeleteActivity(ctx context.Context, serviceURL string, conversationID string, activityID string) error {
+	err := cc.call(ctx, http.MethodDelete, serviceURL, conversationActivityURL, []string{conversationID, activityID}, nil, nil, nil)
+	return errors.Wrap(err, "Failed to delete activity.")
+}
+
+// GetConversationMembers lists the members of a conversation.
+func (cc *ConversationsClient) GetConversationMembers(ctx context.Context, serviceURL string, conversationID string) ([]schema.ChannelAccount, error) {
+	result := []schema.ChannelAccount{}
+	err := cc.call(ctx, http.MethodGet, serviceURL, conversationMembersURL, []string{conversationID}, nil, nil, &result)
+	return result, errors.Wrap(err, "Failed to get conversation members.")
+}
+
+// GetConversationPagedMembers lists the members of a conversation one page at a time.
+// A pageSize of zero lets the channel choose the size of the page. Pass the ContinuationToken of the
+// previous result to get the next page, or an empty string for the first one.
+func (cc *ConversationsClient) GetConversationPagedMembers(ctx context.Context, serviceURL string, conversationID string, pageSize int, continuationToken string) (schema.PagedMembersResult, error) {
+	query := url.Values{}
+	if pageSize > 0 {
+		query.Set("pageSize", strconv.Itoa(pageSize))
+	}
+	if continuationToken != "" {
+		query.Set("continuationToken", continuationToken)
+	}
+	result := schema.PagedMembersResult{}
+	err := cc.call(ctx, http.MethodGet, serviceURL, conversationPagedMembersURL, []string{conversationID}, query, nil, &result)
+	return result, errors.Wrap(err, "Failed to get conversation members.")
+}
+
+// DeleteConversationMember removes a member from a conversation.
+func (cc *ConversationsClient) DeleteConversationMember(ctx context.Context, serviceURL string, conversationID string, memberID string) error {
+	err := cc.call(ctx, http.MethodDelete, serviceURL, conversationMemberURL, []string{conversationID, memberID}, nil, nil, nil)
+	return errors.Wrap(err, "Failed to delete conversation member.")
+}
+
+// GetActivityMembers lists the members of a particular activity in a conversation.
+func (cc *ConversationsClient) GetActivityMembers(ctx context.Context, serviceURL string, conversationID string, activityID string) ([]schema.ChannelAccount, error) {
+	result := []schema.ChannelAccount{}
+	err := cc.call(ctx, http.MethodGet, serviceURL, activityMembersURL, []string{conversationID, activityID}, nil, nil, &result)
+	return result, errors.Wrap(err, "Failed to get activity members.")
+}
+
+// UploadAttachment uploads an attachment to the storage of the channel, to be referenced by activities.
+func (cc *ConversationsClient) UploadAttachment(ctx context.Context, serviceURL string, conversationID string, attachmentUpload schema.AttachmentData) (schema.ResourceResponse, error) {
+	result := schema.ResourceResponse{}
+	err := cc.call(ctx, http.MethodPost, serviceURL, conversationAttachmentsURL, []string{conversationID}, nil, attachmentUpload, &result)
+	return result, errors.Wrap(err, "Failed to upload attachment.")
+}
+
+func (cc *ConversationsClient) call(ctx context.Context, method string, serviceURL string, resourceFormat string, ids []string, query url.Values, body interface{}, result interface{}) error {
+	u, err := ResourceURL(serviceURL, resourceFormat, ids...)
+	if err != nil {
+		return err
+	}
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	return Call(ctx, cc.Client, method, *u, body, result)
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/infracloudio/msbotbuilder-go/connector/auth"
+	"github.com/infracloudio/msbotbuilder-go/connector/client"
+	"github.com/infracloudio/msbotbuilder-go/schema"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestClient starts a connector service mock with a token endpoint, serving the remaining paths with mux.
+func newTestClient(t *testing.T, mux *http.ServeMux) (*client.ConnectorClient, *httptest.Server) {
+	mux.HandleFunc("/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":3600,"access_token":"abc123"}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	config, err := client.NewClientConfig(auth.SimpleCredentialProvider{AppID: "asdasd", Password: "secret"}, srv.URL+"/oauth2/v2.0/token")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	connectorClient, err := client.NewClient(config)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	return connectorClient.(*client.ConnectorClient), srv
+}
+
+func TestConversations(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/conversations", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer abc123", r.Header.Get("Authorization"), "Expect bearer token")
+		switch r.Method {
+		case http.MethodPost:
+			params := schema.ConversationParameters{}
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&params))
+			assert.Equal(t, "12345678", params.Members[0].ID, "Expect members in request body")
+			_, _ = w.Write([]byte(`{"id":"abcd1234","activityId":"1"}`))
+		case http.MethodGet:
+			assert.Equal(t, "next", r.URL.Query().Get("continuationToken"), "Expect continuation token")
+			_, _ = w.Write([]byte(`{"conversations":[{"id":"abcd1234"}]}`))
+		}
+	})
+	mux.HandleFunc("/v3/conversations/abcd1234/pagedmembers", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "10", r.URL.Query().Get("pageSize"), "Expect page size")
+		_, _ = w.Write([]byte(`{"continuationToken":"next","members":[{"id":"12345678"}]}`))
+	})
+	mux.HandleFunc("/v3/conversations/abcd1234/activities/5d5cdc723", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method, "Expect POST method")
+		_, _ = w.Write([]byte(`{"id":"2"}`))
+	})
+	mux.HandleFunc("/v3/conversations/abcd1234/members/12345678", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method, "Expect DELETE method")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	connectorClient, srv := newTestClient(t, mux)
+	conversations := connectorClient.Conversations()
+	ctx := context.Background()
+
+	created, err := conversations.CreateConversation(ctx, srv.URL, schema.ConversationParameters{
+		Members: []schema.ChannelAccount{{ID: "12345678"}},
+	})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, schema.ConversationResourceResponse{ID: "abcd1234", ActivityID: "1"}, created)
+
+	list, err := conversations.GetConversations(ctx, srv.URL, "next")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, "abcd1234", list.Conversations[0].ID)
+
+	members, err := conversations.GetConversationPagedMembers(ctx, srv.URL, "abcd1234", 10, "")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, schema.PagedMembersResult{ContinuationToken: "next", Members: []schema.ChannelAccount{{ID: "12345678"}}}, members)
+
+	reply, err := conversations.ReplyToActivity(ctx, srv.URL, "abcd1234", "5d5cdc723", schema.Activity{Type: schema.Message, Text: "Hi"})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, "2", reply.ID)
+
+	err = conversations.DeleteConversationMember(ctx, srv.URL, "abcd1234", "12345678")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	_, err = conversations.GetConversationMembers(ctx, srv.URL, "unknown")
+	assert.NotNil(t, err, "Expect error for unknown conversation")
+}
+
+// basicClient implements only the methods of client.Client, like clients written before client.Caller.
+type basicClient struct {
+	client.Client
+}
+
+func TestConversationsWithoutCaller(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/conversations/abcd1234/activities/5d5cdc723", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method, "Expect POST method")
+		_, _ = w.Write([]byte(`{"id":"2"}`))
+	})
+	mux.HandleFunc("/v3/conversations/abcd1234/members", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"id":"12345678"}]`))
+	})
+	connectorClient, srv := newTestClient(t, mux)
+	conversations, err := client.NewConversationsClient(basicClient{connectorClient})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	ctx := context.Background()
+
+	members, err := conversations.GetConversationMembers(ctx, srv.URL, "abcd1234")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, []schema.ChannelAccount{{ID: "12345678"}}, members, "Expect response decoded from Get")
+
+	_, err = conversations.ReplyToActivity(ctx, srv.URL, "abcd1234", "5d5cdc723", schema.Activity{Type: schema.Message})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	_, err = conversations.UploadAttachment(ctx, srv.URL, "abcd1234", schema.AttachmentData{Name: "file.txt"})
+	assert.NotNil(t, err, "Expect error posting a body other than an activity")
+}
+
+func TestConversationsEscapeIDs(t *testing.T) {
+	const conversationID = "19:abcd/ef@thread.v2;messageid=1234"
+	var requestURI string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/conversations/", func(w http.ResponseWriter, r *http.Request) {
+		requestURI = r.RequestURI
+		_, _ = w.Write([]byte(`{"id":"2"}`))
+	})
+	connectorClient, srv := newTestClient(t, mux)
+	limiter := &recordingLimiter{}
+	connectorClient.RateLimiter = limiter
+	conversations := connectorClient.Conversations()
+
+	_, err := conversations.ReplyToActivity(context.Background(), srv.URL, conversationID, "1:5d5cdc723", schema.Activity{Type: schema.Message})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, "/v3/conversations/19:abcd%2Fef@thread.v2%3Bmessageid=1234/activities/1:5d5cdc723", requestURI, "Expect each ID escaped as one path segment")
+	assert.Equal(t, []client.RateLimitKey{{ServiceURL: srv.URL, ConversationID: conversationID}}, limiter.keys, "Expect the rate limit key to hold the whole conversation ID")
+}
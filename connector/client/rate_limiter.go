@@ -0,0 +1,235 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/schema"
+)
+
+// RateLimitKey identifies the conversation an activity is sent to.
+type RateLimitKey struct {
+	ChannelID      string
+	ServiceURL     string
+	ConversationID string
+}
+
+// RateLimiter delays activities sent to the connector service to stay within the limits of the channel.
+type RateLimiter interface {
+	// Wait blocks until an activity may be sent to the conversation identified by key.
+	// It returns an error without waiting further if ctx is done first.
+	Wait(ctx context.Context, key RateLimitKey) error
+}
+
+// Rate is the rate of a token bucket: Limit activities per second on average, with bursts of up to
+// Burst activities. The zero Rate is unlimited.
+type Rate struct {
+	Limit float64
+	Burst int
+}
+
+// ConversationRateLimiter is a RateLimiter keeping a token bucket per conversation, identified by
+// the service URL and conversation ID, and an optional global bucket shared by all conversations.
+//
+// Activities are sent in the order Wait was called for the same conversation.
+type ConversationRateLimiter struct {
+	// Default is the rate per conversation of channels without an entry in Channels.
+	Default Rate
+	// Channels holds the rate per conversation by channel ID.
+	Channels map[string]Rate
+	// Global caps the rate of activities sent to all conversations.
+	Global Rate
+	// Now and Sleep, if set, replace time.Now and the timer waiting for the delay of an activity,
+	// e.g. to control the clock in tests. Sleep must return ctx.Err() if ctx is done first.
+	Now   func() time.Time
+	Sleep func(ctx context.Context, delay time.Duration) error
+
+	mu      sync.Mutex
+	global  tokenBucket
+	buckets map[conversationKey]*tokenBucket
+	sweepAt int
+}
+
+type conversationKey struct {
+	serviceURL     string
+	conversationID string
+}
+
+// DefaultRateLimiter returns a ConversationRateLimiter with the limits documented for Microsoft Teams:
+// one activity per second per conversation with bursts of 7, and at most 50 activities per second
+// overall. Conversations in other channels are limited only by the global rate.
+func DefaultRateLimiter() *ConversationRateLimiter {
+	return &ConversationRateLimiter{
+		Channels: map[string]Rate{
+			"msteams": {Limit: 1, Burst: 7},
+		},
+		Global: Rate{Limit: 50, Burst: 50},
+	}
+}
+
+// Wait implements RateLimiter.
+func (rl *ConversationRateLimiter) Wait(ctx context.Context, key RateLimitKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if rl.Now != nil {
+		now = rl.Now()
+	}
+	rl.mu.Lock()
+	rate, ok := rl.Channels[key.ChannelID]
+	if !ok {
+		rate = rl.Default
+	}
+	var bucket *tokenBucket
+	if key.ConversationID != "" && rate.Limit > 0 {
+		bucket = rl.bucket(conversationKey{key.ServiceURL, key.ConversationID}, now)
+	}
+	delay := rl.global.reserve(rl.Global, now)
+	if d := bucket.reserve(rate, now); d > delay {
+		delay = d
+	}
+	rl.mu.Unlock()
+
+	wait := sleep
+	if rl.Sleep != nil {
+		wait = rl.Sleep
+	}
+	if err := wait(ctx, delay); err != nil {
+		// Return the reserved tokens for later activities
+		rl.mu.Lock()
+		rl.global.cancel(rl.Global)
+		bucket.cancel(rate)
+		rl.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// bucket returns the bucket of the conversation, dropping the buckets of idle conversations once
+// their number has doubled since the last sweep.
+func (rl *ConversationRateLimiter) bucket(key conversationKey, now time.Time) *tokenBucket {
+	if bucket, ok := rl.buckets[key]; ok {
+		return bucket
+	}
+	if rl.buckets == nil {
+		rl.buckets = map[conversationKey]*tokenBucket{}
+	}
+	if len(rl.buckets) >= rl.sweepAt {
+		for k, bucket := range rl.buckets {
+			if !now.Before(bucket.full) {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.sweepAt = 2*len(rl.buckets) + 64
+	}
+	bucket := &tokenBucket{}
+	rl.buckets[key] = bucket
+	return bucket
+}
+
+// tokenBucket implements a token bucket allowing tokens to be reserved in advance. The bucket
+// is in debt while the tokens are negative.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// full is the time at which the bucket is refilled
+	full time.Time
+}
+
+// reserve takes a token from the bucket and returns the delay until it is available.
+// A nil bucket or an unlimited rate never delays.
+func (tb *tokenBucket) reserve(rate Rate, now time.Time) time.Duration {
+	if tb == nil || rate.Limit <= 0 {
+		return 0
+	}
+	burst := float64(rate.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if tb.updated.IsZero() {
+		tb.tokens = burst
+	} else if elapsed := now.Sub(tb.updated); elapsed > 0 {
+		tb.tokens += elapsed.Seconds() * rate.Limit
+		if tb.tokens > burst {
+			tb.tokens = burst
+		}
+	}
+	if now.After(tb.updated) {
+		tb.updated = now
+	}
+
+	tb.tokens--
+	tb.full = tb.updated.Add(time.Duration((burst - tb.tokens) / rate.Limit * float64(time.Second)))
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / rate.Limit * float64(time.Second))
+}
+
+// cancel gives back a token taken by reserve.
+func (tb *tokenBucket) cancel(rate Rate) {
+	if tb == nil || rate.Limit <= 0 {
+		return
+	}
+	tb.tokens++
+	tb.full = tb.full.Add(-time.Duration(float64(time.Second) / rate.Limit))
+}
+
+// rateLimitKey identifies the conversation of a request to the connector service from its URL,
+// and the channel from the activity sent, if any.
+func rateLimitKey(target url.URL, body interface{}) RateLimitKey {
+	key := RateLimitKey{}
+	switch activity := body.(type) {
+	case schema.Activity:
+		key.ChannelID = activity.ChannelID
+	case *schema.Activity:
+		key.ChannelID = activity.ChannelID
+	}
+
+	// The escaped path keeps a "/" within the conversation ID apart from the path separators.
+	path := target.EscapedPath()
+	if i := strings.Index(path, "/v3/"); i >= 0 {
+		key.ServiceURL = serviceURLOf(target, path[:i])
+		path = path[i:]
+	} else {
+		key.ServiceURL = serviceURLOf(target, "")
+	}
+
+	const conversationsPath = "/v3/conversations/"
+	if strings.HasPrefix(path, conversationsPath) {
+		segment := strings.SplitN(strings.TrimPrefix(path, conversationsPath), "/", 2)[0]
+		if id, err := url.PathUnescape(segment); err == nil {
+			key.ConversationID = id
+		}
+	}
+	return key
+}
+
+func serviceURLOf(target url.URL, escapedBasePath string) string {
+	u := url.URL{Scheme: target.Scheme, Host: target.Host}
+	return u.String() + escapedBasePath
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/connector/client"
+	"github.com/infracloudio/msbotbuilder-go/schema"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is the clock of a ConversationRateLimiter, recording the delays waited.
+type fakeClock struct {
+	now    time.Time
+	delays []time.Duration
+	err    error
+}
+
+func (fc *fakeClock) Now() time.Time {
+	return fc.now
+}
+
+func (fc *fakeClock) Sleep(ctx context.Context, delay time.Duration) error {
+	fc.delays = append(fc.delays, delay)
+	if fc.err != nil {
+		return fc.err
+	}
+	fc.now = fc.now.Add(delay)
+	return nil
+}
+
+func (fc *fakeClock) limiter(rl *client.ConversationRateLimiter) *client.ConversationRateLimiter {
+	rl.Now = fc.Now
+	rl.Sleep = fc.Sleep
+	return rl
+}
+
+// waitDuration returns how long Wait slept.
+func waitDuration(t *testing.T, fc *fakeClock, rl client.RateLimiter, key client.RateLimitKey) time.Duration {
+	fc.delays = nil
+	err := rl.Wait(context.Background(), key)
+	assert.Nil(t, err, "Expect no error")
+	assert.Len(t, fc.delays, 1, "Expect a single sleep")
+	return fc.delays[0]
+}
+
+func TestConversationRateLimiter(t *testing.T) {
+	conversationA := client.RateLimitKey{ChannelID: "msteams", ServiceURL: "https://service", ConversationID: "a"}
+	conversationB := client.RateLimitKey{ChannelID: "msteams", ServiceURL: "https://service", ConversationID: "b"}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("per conversation", func(t *testing.T) {
+		fc := &fakeClock{now: start}
+		rl := fc.limiter(&client.ConversationRateLimiter{Channels: map[string]client.Rate{"msteams": {Limit: 10, Burst: 2}}})
+		assert.Equal(t, time.Duration(0), waitDuration(t, fc, rl, conversationA), "Expect burst to be sent immediately")
+		assert.Equal(t, time.Duration(0), waitDuration(t, fc, rl, conversationA), "Expect burst to be sent immediately")
+		assert.Equal(t, 100*time.Millisecond, waitDuration(t, fc, rl, conversationA), "Expect activity after burst to wait")
+		assert.Equal(t, time.Duration(0), waitDuration(t, fc, rl, conversationB), "Expect other conversation not to wait")
+
+		fc.now = fc.now.Add(time.Second)
+		assert.Equal(t, time.Duration(0), waitDuration(t, fc, rl, conversationA), "Expect bucket to refill")
+	})
+
+	t.Run("other channel", func(t *testing.T) {
+		fc := &fakeClock{now: start}
+		rl := fc.limiter(&client.ConversationRateLimiter{Channels: map[string]client.Rate{"msteams": {Limit: 10, Burst: 1}}})
+		key := client.RateLimitKey{ChannelID: "slack", ServiceURL: "https://service", ConversationID: "a"}
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, time.Duration(0), waitDuration(t, fc, rl, key), "Expect unlimited default rate")
+		}
+	})
+
+	t.Run("global", func(t *testing.T) {
+		fc := &fakeClock{now: start}
+		rl := fc.limiter(&client.ConversationRateLimiter{Global: client.Rate{Limit: 10, Burst: 1}})
+		assert.Equal(t, time.Duration(0), waitDuration(t, fc, rl, conversationA), "Expect burst to be sent immediately")
+		assert.Equal(t, 100*time.Millisecond, waitDuration(t, fc, rl, conversationB), "Expect global rate to apply to all conversations")
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		fc := &fakeClock{now: start}
+		rl := fc.limiter(&client.ConversationRateLimiter{Default: client.Rate{Limit: 1, Burst: 1}})
+		waitDuration(t, fc, rl, conversationA)
+
+		fc.err = context.DeadlineExceeded
+		err := rl.Wait(context.Background(), conversationA)
+		assert.Equal(t, context.DeadlineExceeded, err, "Expect context error")
+
+		fc.err = nil
+		assert.Equal(t, time.Second, waitDuration(t, fc, rl, conversationA), "Expect tokens of the cancelled activity to be returned")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		fc.delays = nil
+		assert.Equal(t, context.Canceled, rl.Wait(ctx, conversationA), "Expect context error")
+		assert.Empty(t, fc.delays, "Expect no wait once the context is done")
+	})
+}
+
+type recordingLimiter struct {
+	keys []client.RateLimitKey
+}
+
+func (rl *recordingLimiter) Wait(ctx context.Context, key client.RateLimitKey) error {
+	rl.keys = append(rl.keys, key)
+	return nil
+}
+
+func TestClientRateLimiter(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/conversations/19:abcd@thread/activities/1", func(w http.ResponseWriter, r *http.Request) {})
+	connectorClient, srv := newTestClient(t, mux)
+	limiter := &recordingLimiter{}
+	connectorClient.RateLimiter = limiter
+
+	target, err := url.Parse(srv.URL + "/v3/conversations/19:abcd@thread/activities/1")
+	assert.Nil(t, err, "Expect no error")
+	ctx := context.Background()
+	assert.Nil(t, connectorClient.Post(ctx, *target, schema.Activity{ChannelID: "msteams"}), "Expect no error")
+	assert.Nil(t, connectorClient.Put(ctx, *target, schema.Activity{ChannelID: "msteams"}), "Expect no error")
+	assert.Nil(t, connectorClient.Delete(ctx, *target), "Expect no error")
+
+	expected := client.RateLimitKey{ChannelID: "msteams", ServiceURL: srv.URL, ConversationID: "19:abcd@thread"}
+	assert.Equal(t, []client.RateLimitKey{expected, expected}, limiter.keys, "Expect sent activities to be rate limited")
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package client
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/schema/customerror"
+)
+
+// RetryPolicy decides whether a failed request to the connector service is sent again.
+type RetryPolicy interface {
+	// NextRetry is called after every failed attempt, numbered from 1, with either the response
+	// received or the error which prevented receiving one. It returns if the request should be
+	// sent again and the delay to wait before doing so.
+	NextRetry(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool)
+}
+
+// ExponentialBackoff is a RetryPolicy retrying throttled and transiently failed requests, waiting an
+// exponentially growing delay with random jitter between attempts.
+//
+// Throttled requests (429 Too Many Requests) are retried for every method, as the connector service
+// rejects them without processing. Server errors (500, 502, 503, 504) and network errors are retried
+// only for idempotent methods, unless RetryNonIdempotent is set, since e.g. a POST may have created an
+// activity before failing.
+// A delay requested by the Retry-After response header is honoured; the request is not retried if
+// it exceeds MaxDelay.
+type ExponentialBackoff struct {
+	// MaxAttempts is the maximum number of times a request is sent, including the first one.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled for every further retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts.
+	MaxDelay time.Duration
+	// RetryNonIdempotent enables retrying non-idempotent requests on server and network errors.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy returns an ExponentialBackoff suitable for most bots.
+func DefaultRetryPolicy() *ExponentialBackoff {
+	return &ExponentialBackoff{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+	}
+}
+
+// NoRetry is a RetryPolicy sending every request only once.
+type NoRetry struct{}
+
+// NextRetry implements RetryPolicy.
+func (NoRetry) NextRetry(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	return 0, false
+}
+
+// NextRetry implements RetryPolicy.
+func (eb *ExponentialBackoff) NextRetry(attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= eb.MaxAttempts {
+		return 0, false
+	}
+	if err != nil && req.Context().Err() != nil {
+		return 0, false
+	}
+
+	idempotent := eb.RetryNonIdempotent || isIdempotent(req.Method)
+	if resp == nil {
+		if !idempotent {
+			return 0, false
+		}
+		return eb.backoff(attempt), true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		if !idempotent {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	delay := eb.backoff(attempt)
+	retryAfter := customerror.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if eb.MaxDelay > 0 && retryAfter > eb.MaxDelay {
+		return 0, false
+	}
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay, true
+}
+
+// backoff returns the delay before the given retry: half of the exponential delay plus a random
+// share of the other half.
+func (eb *ExponentialBackoff) backoff(attempt int) time.Duration {
+	delay := eb.BaseDelay
+	for i := 1; i < attempt && (eb.MaxDelay <= 0 || delay < eb.MaxDelay); i++ {
+		delay *= 2
+	}
+	if eb.MaxDelay > 0 && delay > eb.MaxDelay {
+		delay = eb.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
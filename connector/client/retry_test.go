@@ -0,0 +1,106 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/connector/client"
+	"github.com/infracloudio/msbotbuilder-go/schema"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// statusSequence responds with the given status codes in turn, then with 200 OK.
+type statusSequence struct {
+	statuses []int
+	requests []*http.Request
+}
+
+func (ss *statusSequence) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ss.requests = append(ss.requests, r)
+	if len(ss.statuses) > 0 {
+		status := ss.statuses[0]
+		ss.statuses = ss.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+	_, _ = w.Write([]byte(`{"id":"1"}`))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := &client.ExponentialBackoff{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+	tests := []struct {
+		name     string
+		method   string
+		statuses []int
+		attempts int
+		fails    bool
+	}{
+		{"idempotent request retried on server error", http.MethodPut, []int{503, 502}, 3, false},
+		{"attempts exhausted", http.MethodGet, []int{500, 500, 500}, 3, true},
+		{"non-idempotent request not retried on server error", http.MethodPost, []int{503}, 1, true},
+		{"throttled request retried", http.MethodPost, []int{429}, 2, false},
+		{"client error not retried", http.MethodPut, []int{400}, 1, true},
+		{"token refreshed once on unauthorized", http.MethodPost, []int{401}, 2, false},
+		{"unauthorized after token refresh", http.MethodPost, []int{401, 401}, 2, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			seq := &statusSequence{statuses: test.statuses}
+			mux := http.NewServeMux()
+			mux.Handle("/v3/conversations/abcd1234/activities/1", seq)
+			connectorClient, srv := newTestClient(t, mux)
+			connectorClient.RetryPolicy = policy
+
+			target, err := url.Parse(srv.URL + "/v3/conversations/abcd1234/activities/1")
+			assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+			err = connectorClient.Call(context.Background(), test.method, *target, schema.Activity{Type: schema.Message}, nil)
+			assert.Equal(t, test.fails, err != nil, fmt.Sprintf("Unexpected error %v", err))
+			assert.Equal(t, test.attempts, len(seq.requests), "Unexpected number of attempts")
+			assert.NotZero(t, seq.requests[0].ContentLength, "Expect request body")
+			for _, r := range seq.requests {
+				assert.Equal(t, seq.requests[0].ContentLength, r.ContentLength, "Expect body to be sent with every attempt")
+			}
+		})
+	}
+}
+
+func TestRetryAfterHonoured(t *testing.T) {
+	policy := &client.ExponentialBackoff{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Second}
+	req := httptest.NewRequest(http.MethodPost, "/v3/conversations/abcd1234/activities", nil)
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"2"}}}
+
+	delay, retry := policy.NextRetry(1, req, resp, nil)
+	assert.True(t, retry, "Expect throttled request to be retried")
+	assert.Equal(t, 2*time.Second, delay, "Expect Retry-After delay")
+
+	resp.Header.Set("Retry-After", "60")
+	_, retry = policy.NextRetry(1, req, resp, nil)
+	assert.False(t, retry, "Expect no retry when Retry-After exceeds MaxDelay")
+}
@@ -21,7 +21,6 @@ package activity
 
 import (
 	"errors"
-	"fmt"
 
 	"github.com/infracloudio/msbotbuilder-go/schema"
 )
@@ -33,13 +32,59 @@ type Handler interface {
 	OnConversationUpdate(context *TurnContext) (schema.Activity, error)
 }
 
+// ActivityHandler extends Handler with actions for the remaining activity types of the connector service.
+//
+// It is optional: PrepareActivityContext routes these activity types only when the Handler
+// implements it and ignores them otherwise. Embedding HandlerFuncs is the simplest way to
+// satisfy it while overriding only the methods of interest.
+type ActivityHandler interface {
+	Handler
+	OnTyping(context *TurnContext) (schema.Activity, error)
+	OnEvent(context *TurnContext) (schema.Activity, error)
+	OnEndOfConversation(context *TurnContext) (schema.Activity, error)
+	OnMessageReaction(context *TurnContext) (schema.Activity, error)
+	OnMessageUpdate(context *TurnContext) (schema.Activity, error)
+	OnMessageDelete(context *TurnContext) (schema.Activity, error)
+	OnInstallationUpdate(context *TurnContext) (schema.Activity, error)
+	OnContactRelationUpdate(context *TurnContext) (schema.Activity, error)
+	OnDeleteUserData(context *TurnContext) (schema.Activity, error)
+	OnSuggestion(context *TurnContext) (schema.Activity, error)
+	OnHandoff(context *TurnContext) (schema.Activity, error)
+	OnTrace(context *TurnContext) (schema.Activity, error)
+}
+
 // HandlerFuncs is an adaptor to let client program specify as many or
 // as few functions to handle events of the connector service while still implementing
-// Handler.
+// ActivityHandler and InvokeHandler.
+//
+// Activity types other than 'message', 'invoke' and 'conversationUpdate' are silently
+// ignored when no function is specified for them.
+//
+// The OnMembers* and OnReactions* functions are called for 'conversationUpdate' and
+// 'messageReaction' events respectively, unless OnConversationUpdateFunc or
+// OnMessageReactionFunc is specified, which then takes precedence.
 type HandlerFuncs struct {
-	OnMessageFunc            func(turn *TurnContext) (schema.Activity, error)
-	OnInvokeFunc             func(turn *TurnContext) (schema.Activity, error)
-	OnConversationUpdateFunc func(turn *TurnContext) (schema.Activity, error)
+	OnMessageFunc               func(turn *TurnContext) (schema.Activity, error)
+	OnInvokeFunc                func(turn *TurnContext) (schema.Activity, error)
+	OnInvokeActivityFunc        func(turn *TurnContext) (InvokeResponse, error)
+	OnConversationUpdateFunc    func(turn *TurnContext) (schema.Activity, error)
+	OnTypingFunc                func(turn *TurnContext) (schema.Activity, error)
+	OnEventFunc                 func(turn *TurnContext) (schema.Activity, error)
+	OnEndOfConversationFunc     func(turn *TurnContext) (schema.Activity, error)
+	OnMessageReactionFunc       func(turn *TurnContext) (schema.Activity, error)
+	OnMessageUpdateFunc         func(turn *TurnContext) (schema.Activity, error)
+	OnMessageDeleteFunc         func(turn *TurnContext) (schema.Activity, error)
+	OnInstallationUpdateFunc    func(turn *TurnContext) (schema.Activity, error)
+	OnContactRelationUpdateFunc func(turn *TurnContext) (schema.Activity, error)
+	OnDeleteUserDataFunc        func(turn *TurnContext) (schema.Activity, error)
+	OnSuggestionFunc            func(turn *TurnContext) (schema.Activity, error)
+	OnHandoffFunc               func(turn *TurnContext) (schema.Activity, error)
+	OnTraceFunc                 func(turn *TurnContext) (schema.Activity, error)
+
+	OnMembersAddedFunc     func(members []schema.ChannelAccount, turn *TurnContext) (schema.Activity, error)
+	OnMembersRemovedFunc   func(members []schema.ChannelAccount, turn *TurnContext) (schema.Activity, error)
+	OnReactionsAddedFunc   func(reactions []schema.MessageReaction, turn *TurnContext) (schema.Activity, error)
+	OnReactionsRemovedFunc func(reactions []schema.MessageReaction, turn *TurnContext) (schema.Activity, error)
 }
 
 // OnMessage handles a 'message' event from connector service.
@@ -47,15 +92,32 @@ func (r HandlerFuncs) OnMessage(turn *TurnContext) (schema.Activity, error) {
 	if r.OnMessageFunc != nil {
 		return r.OnMessageFunc(turn)
 	}
-	return schema.Activity{}, errors.New("No handler found for this activity type")
+	return schema.Activity{}, ErrNotHandled
 }
 
 // OnConversationUpdate handles a 'conversationUpdate' event from connector service.
+//
+// Without OnConversationUpdateFunc, the members added to and removed from the conversation
+// are passed to OnMembersAddedFunc and OnMembersRemovedFunc, in this order when the activity
+// carries both. The bot itself is never reported as an added or removed member.
+// If both functions reply, the first reply is sent right away and the second is returned.
+// Returns ErrNotHandled if none of these functions is specified.
 func (r HandlerFuncs) OnConversationUpdate(turn *TurnContext) (schema.Activity, error) {
 	if r.OnConversationUpdateFunc != nil {
 		return r.OnConversationUpdateFunc(turn)
 	}
-	return schema.Activity{}, errors.New("No handler found for this activity type")
+	if r.OnMembersAddedFunc == nil && r.OnMembersRemovedFunc == nil {
+		return schema.Activity{}, ErrNotHandled
+	}
+
+	var replies []func() (schema.Activity, error)
+	if added := excludeRecipient(turn.Activity.MembersAdded, turn.Activity.Recipient); len(added) > 0 && r.OnMembersAddedFunc != nil {
+		replies = append(replies, func() (schema.Activity, error) { return r.OnMembersAddedFunc(added, turn) })
+	}
+	if removed := excludeRecipient(turn.Activity.MembersRemoved, turn.Activity.Recipient); len(removed) > 0 && r.OnMembersRemovedFunc != nil {
+		replies = append(replies, func() (schema.Activity, error) { return r.OnMembersRemovedFunc(removed, turn) })
+	}
+	return callSubHandlers(turn, replies)
 }
 
 // OnInvoke handles a 'invoke' event from connector service.
@@ -63,19 +125,193 @@ func (r HandlerFuncs) OnInvoke(turn *TurnContext) (schema.Activity, error) {
 	if r.OnInvokeFunc != nil {
 		return r.OnInvokeFunc(turn)
 	}
-	return schema.Activity{}, errors.New("No handler found for this activity type")
+	return schema.Activity{}, ErrNotHandled
+}
+
+// OnInvokeActivity handles a 'invoke' event from connector service which expects an InvokeResponse.
+// Returns ErrNotHandled if no OnInvokeActivityFunc is specified, so that OnInvoke is used instead.
+func (r HandlerFuncs) OnInvokeActivity(turn *TurnContext) (InvokeResponse, error) {
+	if r.OnInvokeActivityFunc != nil {
+		return r.OnInvokeActivityFunc(turn)
+	}
+	return InvokeResponse{}, ErrNotHandled
+}
+
+// OnTyping handles a 'typing' event from connector service.
+func (r HandlerFuncs) OnTyping(turn *TurnContext) (schema.Activity, error) {
+	return callHandlerFunc(r.OnTypingFunc, turn)
+}
+
+// OnEvent handles an 'event' event from connector service.
+func (r HandlerFuncs) OnEvent(turn *TurnContext) (schema.Activity, error) {
+	return callHandlerFunc(r.OnEventFunc, turn)
+}
+
+// OnEndOfConversation handles an 'endOfConversation' event from connector service.
+func (r HandlerFuncs) OnEndOfConversation(turn *TurnContext) (schema.Activity, error) {
+	return callHandlerFunc(r.OnEndOfConversationFunc, turn)
+}
+
+// OnMessageReaction handles a 'messageReaction' event from connector service.
+//
+// Without OnMessageReactionFunc, the reactions added to and removed from a message
+// are passed to OnReactionsAddedFunc and OnReactionsRemovedFunc, in this order when the
+// activity carries both. If both functions reply, the first reply is sent right away and
+// the second is returned. Returns ErrNotHandled if none of these functions is specified.
+func (r HandlerFuncs) OnMessageReaction(turn *TurnContext) (schema.Activity, error) {
+	if r.OnMessageReactionFunc != nil {
+		return r.OnMessageReactionFunc(turn)
+	}
+	if r.OnReactionsAddedFunc == nil && r.OnReactionsRemovedFunc == nil {
+		return schema.Activity{}, ErrNotHandled
+	}
+
+	var replies []func() (schema.Activity, error)
+	if added := turn.Activity.ReactionsAdded; len(added) > 0 && r.OnReactionsAddedFunc != nil {
+		replies = append(replies, func() (schema.Activity, error) { return r.OnReactionsAddedFunc(added, turn) })
+	}
+	if removed := turn.Activity.ReactionsRemoved; len(removed) > 0 && r.OnReactionsRemovedFunc != nil {
+		replies = append(replies, func() (schema.Activity, error) { return r.OnReactionsRemovedFunc(removed, turn) })
+	}
+	return callSubHandlers(turn, replies)
+}
+
+// OnMessageUpdate handles a 'messageUpdate' event from connector service.
+func (r HandlerFuncs) OnMessageUpdate(turn *TurnContext) (schema.Activity, error) {
+	return callHandlerFunc(r.OnMessageUpdateFunc, turn)
+}
+
+// OnMessageDelete handles a 'messageDelete' event from connector service.
+func (r HandlerFuncs) OnMessageDelete(turn *TurnContext) (schema.Activity, error) {
+	return callHandlerFunc(r.OnMessageDeleteFunc, turn)
+}
+
+// OnInstallationUpdate handles an 'installationUpdate' event from connector service.
+func (r HandlerFuncs) OnInstallationUpdate(turn *TurnContext) (schema.Activity, error) {
+	return callHandlerFunc(r.OnInstallationUpdateFunc, turn)
+}
+
+// OnContactRelationUpdate handles a 'contactRelationUpdate' event from connector service.
+func (r HandlerFuncs) OnContactRelationUpdate(turn *TurnContext) (schema.Activity, error) {
+	return callHandlerFunc(r.OnContactRelationUpdateFunc, turn)
+}
+
+// OnDeleteUserData handles a 'deleteUserData' event from connector service.
+func (r HandlerFuncs) OnDeleteUserData(turn *TurnContext) (schema.Activity, error) {
+	return callHandlerFunc(r.OnDeleteUserDataFunc, turn)
+}
+
+// OnSuggestion handles a 'suggestion' event from connector service.
+func (r HandlerFuncs) OnSuggestion(turn *TurnContext) (schema.Activity, error) {
+	return callHandlerFunc(r.OnSuggestionFunc, turn)
+}
+
+// OnHandoff handles a 'handoff' event from connector service.
+func (r HandlerFuncs) OnHandoff(turn *TurnContext) (schema.Activity, error) {
+	return callHandlerFunc(r.OnHandoffFunc, turn)
+}
+
+// OnTrace handles a 'trace' event from connector service.
+func (r HandlerFuncs) OnTrace(turn *TurnContext) (schema.Activity, error) {
+	return callHandlerFunc(r.OnTraceFunc, turn)
+}
+
+// callHandlerFunc calls fn if it is specified. A missing function is a no-op.
+func callHandlerFunc(fn func(turn *TurnContext) (schema.Activity, error), turn *TurnContext) (schema.Activity, error) {
+	if fn != nil {
+		return fn(turn)
+	}
+	return schema.Activity{}, nil
+}
+
+// callSubHandlers calls the handler functions in order and returns the reply of the last one.
+// Earlier replies are sent right away, so that none is lost.
+func callSubHandlers(turn *TurnContext, handlers []func() (schema.Activity, error)) (schema.Activity, error) {
+	var pending schema.Activity
+	for _, handler := range handlers {
+		reply, err := handler()
+		if err != nil {
+			return schema.Activity{}, err
+		}
+		if reply.Type == "" {
+			continue
+		}
+		if pending.Type != "" {
+			if _, err := turn.SendActivities(turn.Context(), []schema.Activity{pending}); err != nil {
+				return schema.Activity{}, err
+			}
+		}
+		pending = reply
+	}
+	return pending, nil
+}
+
+// excludeRecipient returns the members other than the recipient of the activity, i.e. the bot itself.
+func excludeRecipient(members []schema.ChannelAccount, recipient schema.ChannelAccount) []schema.ChannelAccount {
+	filtered := make([]schema.ChannelAccount, 0, len(members))
+	for _, member := range members {
+		if member.ID != recipient.ID {
+			filtered = append(filtered, member)
+		}
+	}
+	return filtered
 }
 
 // PrepareActivityContext routes the received Activity to respective handler function.
 // Returns the result of the handler function.
+//
+// The InvokeResponse returned by an InvokeHandler is kept in the TurnContext.
+//
+// Activity types which the handler does not support are ignored and an empty Activity is returned.
 func PrepareActivityContext(handler Handler, context *TurnContext) (schema.Activity, error) {
 	switch context.Activity.Type {
 	case schema.Message:
 		return handler.OnMessage(context)
 	case schema.Invoke:
+		if ih, ok := handler.(InvokeHandler); ok {
+			invokeResponse, err := ih.OnInvokeActivity(context)
+			if !errors.Is(err, ErrNotHandled) {
+				if err == nil {
+					context.invokeResponse = &invokeResponse
+				}
+				return schema.Activity{}, err
+			}
+		}
 		return handler.OnInvoke(context)
 	case schema.ConversationUpdate:
 		return handler.OnConversationUpdate(context)
 	}
-	return schema.Activity{}, fmt.Errorf("Activity type %s not supported yet", context.Activity.Type)
+
+	ah, ok := handler.(ActivityHandler)
+	if !ok {
+		return schema.Activity{}, nil
+	}
+
+	switch context.Activity.Type {
+	case schema.Typing:
+		return ah.OnTyping(context)
+	case schema.Event:
+		return ah.OnEvent(context)
+	case schema.EndOfConversation:
+		return ah.OnEndOfConversation(context)
+	case schema.MsgReaction:
+		return ah.OnMessageReaction(context)
+	case schema.MessageUpdate:
+		return ah.OnMessageUpdate(context)
+	case schema.MessageDelete:
+		return ah.OnMessageDelete(context)
+	case schema.InstallationUpdate:
+		return ah.OnInstallationUpdate(context)
+	case schema.ContactRelationUpdate:
+		return ah.OnContactRelationUpdate(context)
+	case schema.DeleteUserData:
+		return ah.OnDeleteUserData(context)
+	case schema.Suggestion:
+		return ah.OnSuggestion(context)
+	case schema.Handoff:
+		return ah.OnHandoff(context)
+	case schema.Trace:
+		return ah.OnTrace(context)
+	}
+	return schema.Activity{}, nil
 }
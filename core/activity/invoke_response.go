@@ -0,0 +1,44 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package activity
+
+import (
+	"errors"
+)
+
+// ErrNotHandled is returned by HandlerFuncs when no function is specified for a received activity
+// which requires one.
+var ErrNotHandled = errors.New("No handler found for this activity type")
+
+// InvokeResponse is the synchronous reply to an 'invoke' activity, sent back to the connector
+// service in the body of the HTTP response.
+type InvokeResponse struct {
+	// Status is the HTTP status code of the response. Zero means http.StatusOK.
+	Status int
+	// Body is the JSON encoded payload of the response, if not nil.
+	Body interface{}
+}
+
+// InvokeHandler is an optional interface for a Handler to answer 'invoke' activities with an InvokeResponse.
+//
+// OnInvokeActivity takes precedence over OnInvoke, unless it returns ErrNotHandled.
+type InvokeHandler interface {
+	OnInvokeActivity(context *TurnContext) (InvokeResponse, error)
+}
@@ -21,9 +21,7 @@ package activity
 
 import (
 	"context"
-	"fmt"
-	"net/url"
-	"path"
+	"net/http"
 
 	"github.com/infracloudio/msbotbuilder-go/connector/client"
 	"github.com/infracloudio/msbotbuilder-go/schema"
@@ -37,12 +35,19 @@ type Response interface {
 	UpdateActivity(ctx context.Context, activity schema.Activity) error
 }
 
+// ResourceResponder is implemented by Responses, like DefaultResponse, which return the ResourceResponse
+// of the activities sent and updated, holding the ID assigned by the connector service.
+type ResourceResponder interface {
+	SendActivityWithResponse(ctx context.Context, activity schema.Activity) (schema.ResourceResponse, error)
+	UpdateActivityWithResponse(ctx context.Context, activity schema.Activity) (schema.ResourceResponse, error)
+}
+
 const (
 	// APIVersion for response URLs
 	APIVersion = "v3"
 
-	sendToConversationURL = "/%s/conversations/%s/activities"
-	activityResourceURL   = "/%s/conversations/%s/activities/%s"
+	sendToConversationURL = "/" + APIVersion + "/conversations/%s/activities"
+	activityResourceURL   = "/" + APIVersion + "/conversations/%s/activities/%s"
 )
 
 // DefaultResponse is the default implementation of Response.
@@ -52,52 +57,59 @@ type DefaultResponse struct {
 
 // DeleteActivity sends a Delete activity method to the BOT connector service.
 func (response *DefaultResponse) DeleteActivity(ctx context.Context, activity schema.Activity) error {
-	u, err := url.Parse(activity.ServiceURL)
+	u, err := client.ResourceURL(activity.ServiceURL, activityResourceURL, activity.Conversation.ID, activity.ID)
 	if err != nil {
-		return errors.Wrapf(err, "Failed to parse ServiceURL %s.", activity.ServiceURL)
+		return err
 	}
 
-	respPath := fmt.Sprintf(activityResourceURL, APIVersion, activity.Conversation.ID, activity.ID)
-
 	// Send activity to client
-	u.Path = path.Join(u.Path, respPath)
 	err = response.Client.Delete(ctx, *u)
 	return errors.Wrap(err, "Failed to delete response.")
 }
 
 // SendActivity sends an activity to the BOT connector service.
 func (response *DefaultResponse) SendActivity(ctx context.Context, activity schema.Activity) error {
-	u, err := url.Parse(activity.ServiceURL)
-	if err != nil {
-		return errors.Wrapf(err, "Failed to parse ServiceURL %s.", activity.ServiceURL)
-	}
+	_, err := response.SendActivityWithResponse(ctx, activity)
+	return err
+}
 
-	respPath := fmt.Sprintf(sendToConversationURL, APIVersion, activity.Conversation.ID)
+// SendActivityWithResponse sends an activity to the BOT connector service.
+// Returns the ID assigned to the activity by the connector service.
+func (response *DefaultResponse) SendActivityWithResponse(ctx context.Context, activity schema.Activity) (schema.ResourceResponse, error) {
+	u, err := client.ResourceURL(activity.ServiceURL, sendToConversationURL, activity.Conversation.ID)
 
 	// if ReplyToID is set in the activity, we send reply to that particular activity
 	if activity.ReplyToID != "" {
-		respPath = fmt.Sprintf(activityResourceURL, APIVersion, activity.Conversation.ID, activity.ID)
+		u, err = client.ResourceURL(activity.ServiceURL, activityResourceURL, activity.Conversation.ID, activity.ID)
+	}
+	if err != nil {
+		return schema.ResourceResponse{}, err
 	}
 
 	// Send activity to client
-	u.Path = path.Join(u.Path, respPath)
-	err = response.Client.Post(ctx, *u, activity)
-	return errors.Wrap(err, "Failed to send response.")
+	resource := schema.ResourceResponse{}
+	err = client.Call(ctx, response.Client, http.MethodPost, *u, activity, &resource)
+	return resource, errors.Wrap(err, "Failed to send response.")
 }
 
 // UpdateActivity sends a Put activity method to the BOT connector service.
 func (response *DefaultResponse) UpdateActivity(ctx context.Context, activity schema.Activity) error {
-	u, err := url.Parse(activity.ServiceURL)
+	_, err := response.UpdateActivityWithResponse(ctx, activity)
+	return err
+}
+
+// UpdateActivityWithResponse sends a Put activity method to the BOT connector service.
+// Returns the response of the connector service, holding the ID of the activity.
+func (response *DefaultResponse) UpdateActivityWithResponse(ctx context.Context, activity schema.Activity) (schema.ResourceResponse, error) {
+	u, err := client.ResourceURL(activity.ServiceURL, activityResourceURL, activity.Conversation.ID, activity.ID)
 	if err != nil {
-		return errors.Wrapf(err, "Failed to parse ServiceURL %s.", activity.ServiceURL)
+		return schema.ResourceResponse{}, err
 	}
 
-	respPath := fmt.Sprintf(activityResourceURL, APIVersion, activity.Conversation.ID, activity.ID)
-
 	// Send activity to client
-	u.Path = path.Join(u.Path, respPath)
-	err = response.Client.Put(ctx, *u, activity)
-	return errors.Wrap(err, "Failed to update response.")
+	resource := schema.ResourceResponse{}
+	err = client.Call(ctx, response.Client, http.MethodPut, *u, activity, &resource)
+	return resource, errors.Wrap(err, "Failed to update response.")
 }
 
 // NewActivityResponse provides a DefaultResponse implementaton of Response.
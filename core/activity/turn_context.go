@@ -20,6 +20,9 @@
 package activity
 
 import (
+	"context"
+
+	"github.com/infracloudio/msbotbuilder-go/connector/client"
 	"github.com/infracloudio/msbotbuilder-go/schema"
 	"github.com/pkg/errors"
 )
@@ -28,8 +31,48 @@ import (
 // program of this SDK.
 //
 // The return value is Activity as provided by the client program, to be send to the connector service.
+// A TurnContext created with NewTurnContext is also bound to a connector client and can send,
+// update and delete any number of activities while the turn is being processed.
 type TurnContext struct {
 	Activity schema.Activity
+
+	ctx            context.Context
+	response       Response
+	responded      bool
+	invokeResponse *InvokeResponse
+	turnState      map[interface{}]interface{}
+
+	sendActivitiesHooks []SendActivitiesHook
+	updateActivityHooks []UpdateActivityHook
+	deleteActivityHooks []DeleteActivityHook
+}
+
+// SendActivitiesFunc delivers activities to the connector service, or passes them to the next SendActivitiesHook.
+type SendActivitiesFunc func(ctx context.Context, activities []schema.Activity) ([]schema.ResourceResponse, error)
+
+// SendActivitiesHook intercepts the activities sent during a turn. It may change them before passing them
+// to next, act on the responses returned by next, or not call next to drop them.
+type SendActivitiesHook func(ctx context.Context, turn *TurnContext, activities []schema.Activity, next SendActivitiesFunc) ([]schema.ResourceResponse, error)
+
+// UpdateActivityFunc replaces an activity, or passes it to the next UpdateActivityHook.
+type UpdateActivityFunc func(ctx context.Context, activity schema.Activity) (schema.ResourceResponse, error)
+
+// UpdateActivityHook intercepts the activities updated during a turn, like a SendActivitiesHook.
+type UpdateActivityHook func(ctx context.Context, turn *TurnContext, activity schema.Activity, next UpdateActivityFunc) (schema.ResourceResponse, error)
+
+// DeleteActivityFunc deletes an activity, or passes its ID to the next DeleteActivityHook.
+type DeleteActivityFunc func(ctx context.Context, activityID string) error
+
+// DeleteActivityHook intercepts the activities deleted during a turn, like a SendActivitiesHook.
+type DeleteActivityHook func(ctx context.Context, turn *TurnContext, activityID string, next DeleteActivityFunc) error
+
+// NewTurnContext creates a TurnContext for the received activity, bound to the given connector client.
+func NewTurnContext(activity schema.Activity, connectorClient client.Client) *TurnContext {
+	turn := &TurnContext{Activity: activity}
+	if connectorClient != nil {
+		turn.response = &DefaultResponse{connectorClient}
+	}
+	return turn
 }
 
 // SendActivity sends an activity to user.
@@ -42,6 +85,186 @@ func (t *TurnContext) SendActivity(options ...MsgOption) (schema.Activity, error
 	return ApplyConversationReference(activity, GetCoversationReference(t.Activity), false), nil
 }
 
+// Send prepares a message activity like SendActivity and delivers it to the connector service right away.
+// Returns the ID assigned to the sent activity.
+func (t *TurnContext) Send(ctx context.Context, options ...MsgOption) (schema.ResourceResponse, error) {
+	activity, err := t.SendActivity(options...)
+	if err != nil {
+		return schema.ResourceResponse{}, err
+	}
+	responses, err := t.SendActivities(ctx, []schema.Activity{activity})
+	if err != nil {
+		return schema.ResourceResponse{}, err
+	}
+	return responses[0], nil
+}
+
+// SendActivities delivers the activities to the connector service in the given order.
+// Each activity is sent only after the previous one has been accepted.
+//
+// Activities without a ServiceURL and Conversation are addressed to the conversation of this turn,
+// and an empty activity type defaults to 'message'.
+// Returns the IDs of the activities sent before any error occurred.
+//
+// The activities are passed through the hooks added with OnSendActivities before being delivered.
+func (t *TurnContext) SendActivities(ctx context.Context, activities []schema.Activity) ([]schema.ResourceResponse, error) {
+	addressed := make([]schema.Activity, len(activities))
+	for i, activity := range activities {
+		activity = t.addressActivity(activity)
+		if activity.Type == "" {
+			activity.Type = schema.Message
+		}
+		addressed[i] = activity
+	}
+
+	send := t.deliverActivities
+	for i := len(t.sendActivitiesHooks) - 1; i >= 0; i-- {
+		hook, next := t.sendActivitiesHooks[i], send
+		send = func(ctx context.Context, activities []schema.Activity) ([]schema.ResourceResponse, error) {
+			return hook(ctx, t, activities, next)
+		}
+	}
+	return send(ctx, addressed)
+}
+
+// deliverActivities sends the activities to the connector service one at a time.
+func (t *TurnContext) deliverActivities(ctx context.Context, activities []schema.Activity) ([]schema.ResourceResponse, error) {
+	if t.response == nil {
+		return nil, errors.New("TurnContext is not bound to a connector client")
+	}
+
+	responses := make([]schema.ResourceResponse, 0, len(activities))
+	for _, activity := range activities {
+		resource, err := t.sendActivity(ctx, activity)
+		if err != nil {
+			return responses, err
+		}
+		t.responded = true
+		responses = append(responses, resource)
+	}
+	return responses, nil
+}
+
+// UpdateActivity replaces an activity previously sent to the conversation.
+// The ID of the activity identifies the activity to be replaced.
+// The activity is passed through the hooks added with OnUpdateActivity.
+func (t *TurnContext) UpdateActivity(ctx context.Context, activity schema.Activity) (schema.ResourceResponse, error) {
+	update := func(ctx context.Context, activity schema.Activity) (schema.ResourceResponse, error) {
+		if t.response == nil {
+			return schema.ResourceResponse{}, errors.New("TurnContext is not bound to a connector client")
+		}
+		if responder, ok := t.response.(ResourceResponder); ok {
+			return responder.UpdateActivityWithResponse(ctx, activity)
+		}
+		return schema.ResourceResponse{}, t.response.UpdateActivity(ctx, activity)
+	}
+	for i := len(t.updateActivityHooks) - 1; i >= 0; i-- {
+		hook, next := t.updateActivityHooks[i], update
+		update = func(ctx context.Context, activity schema.Activity) (schema.ResourceResponse, error) {
+			return hook(ctx, t, activity, next)
+		}
+	}
+	return update(ctx, t.addressActivity(activity))
+}
+
+// DeleteActivity deletes an activity previously sent to the conversation of this turn.
+// The activity ID is passed through the hooks added with OnDeleteActivity.
+func (t *TurnContext) DeleteActivity(ctx context.Context, activityID string) error {
+	remove := func(ctx context.Context, activityID string) error {
+		if t.response == nil {
+			return errors.New("TurnContext is not bound to a connector client")
+		}
+		activity := ApplyConversationReference(schema.Activity{Type: schema.Message}, GetCoversationReference(t.Activity), true)
+		activity.ID = activityID
+		return t.response.DeleteActivity(ctx, activity)
+	}
+	for i := len(t.deleteActivityHooks) - 1; i >= 0; i-- {
+		hook, next := t.deleteActivityHooks[i], remove
+		remove = func(ctx context.Context, activityID string) error {
+			return hook(ctx, t, activityID, next)
+		}
+	}
+	return remove(ctx, activityID)
+}
+
+// OnSendActivities adds hooks called, in the order added, with the activities sent during this turn.
+// Activities are addressed to the conversation of this turn before being passed to the hooks.
+func (t *TurnContext) OnSendActivities(hooks ...SendActivitiesHook) *TurnContext {
+	t.sendActivitiesHooks = append(t.sendActivitiesHooks, hooks...)
+	return t
+}
+
+// OnUpdateActivity adds hooks called, in the order added, with the activities updated during this turn.
+func (t *TurnContext) OnUpdateActivity(hooks ...UpdateActivityHook) *TurnContext {
+	t.updateActivityHooks = append(t.updateActivityHooks, hooks...)
+	return t
+}
+
+// OnDeleteActivity adds hooks called, in the order added, with the IDs of the activities deleted during this turn.
+func (t *TurnContext) OnDeleteActivity(hooks ...DeleteActivityHook) *TurnContext {
+	t.deleteActivityHooks = append(t.deleteActivityHooks, hooks...)
+	return t
+}
+
+// Responded returns if at least one activity has been sent during this turn.
+func (t *TurnContext) Responded() bool {
+	return t.responded
+}
+
+// InvokeResponse returns the response to the 'invoke' activity of this turn, if an InvokeHandler provided one.
+func (t *TurnContext) InvokeResponse() (InvokeResponse, bool) {
+	if t.invokeResponse == nil {
+		return InvokeResponse{}, false
+	}
+	return *t.invokeResponse, true
+}
+
+// sendActivity sends the activity with the Response, returning its ResourceResponse if the Response provides it.
+func (t *TurnContext) sendActivity(ctx context.Context, activity schema.Activity) (schema.ResourceResponse, error) {
+	if responder, ok := t.response.(ResourceResponder); ok {
+		return responder.SendActivityWithResponse(ctx, activity)
+	}
+	return schema.ResourceResponse{}, t.response.SendActivity(ctx, activity)
+}
+
+// Context returns the context of the turn, which handlers use for the requests they make, like sending
+// activities. The adapter sets it to the context passed along by the middleware. It defaults to
+// context.Background().
+func (t *TurnContext) Context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// SetContext replaces the context of the turn.
+func (t *TurnContext) SetContext(ctx context.Context) {
+	t.ctx = ctx
+}
+
+// TurnState returns the value stored under the key for the duration of this turn by SetTurnState.
+func (t *TurnContext) TurnState(key interface{}) (interface{}, bool) {
+	value, ok := t.turnState[key]
+	return value, ok
+}
+
+// SetTurnState stores a value under the key for the duration of this turn, like the state loaded by
+// state.BotState. As for context.WithValue, keys should be of an unexported type to avoid collisions.
+func (t *TurnContext) SetTurnState(key, value interface{}) {
+	if t.turnState == nil {
+		t.turnState = map[interface{}]interface{}{}
+	}
+	t.turnState[key] = value
+}
+
+// addressActivity sets the delivery information of this turn on an activity which has none.
+func (t *TurnContext) addressActivity(activity schema.Activity) schema.Activity {
+	if activity.ServiceURL != "" || activity.Conversation.ID != "" {
+		return activity
+	}
+	return ApplyConversationReference(activity, GetCoversationReference(t.Activity), false)
+}
+
 func applyMsgOptions(activity schema.Activity, options ...MsgOption) (schema.Activity, error) {
 	for _, opt := range options {
 		if err := opt(&activity); err != nil {
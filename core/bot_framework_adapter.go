@@ -41,7 +41,31 @@ type Adapter interface {
 	UpdateActivity(ctx context.Context, activity schema.Activity) error
 }
 
+// ActivityServer is implemented by adapters, like BotFrameworkAdapter, which write the HTTP reply to a
+// received activity themselves, including the response to 'invoke' activities.
+type ActivityServer interface {
+	ServeActivity(ctx context.Context, w http.ResponseWriter, req schema.Activity, handler activity.Handler) error
+}
+
 // AdapterSetting is the configuration for the Adapter.
+//
+// The ChannelEnvironment, if not set, is selected by the ChannelService: empty for the public cloud or
+// auth.GovernmentChannelService for the US Government cloud. It provides the defaults of the other
+// endpoints and the issuers of valid tokens from channels.
+//
+// Tokens for the connector service are requested from the ChannelAuthTenant, botframework.com in the public
+// cloud, which single-tenant bots set to the tenant of their app registration. OauthEndpoint is the login URL
+// prefix, https://login.microsoftonline.com/ in the public cloud.
+//
+// The tokens are requested with the AppID and AppPassword, or the CredentialProvider if set, unless a
+// TokenSource like auth.ManagedIdentityTokenSource provides them.
+//
+// Tokens from channels are validated with the keys referenced by the OpenIDMetadata URL, by default the one
+// of the ChannelEnvironment. The AuthClient, if set, is also used to fetch the metadata and keys, and by the
+// token sources of package auth without an HTTPClient.
+//
+// Failed requests to the connector service are retried by the RetryPolicy, client.DefaultRetryPolicy() if
+// not set. Set it to client.NoRetry{} to disable retries.
 type AdapterSetting struct {
 	AppID              string
 	AppPassword        string
@@ -49,9 +73,14 @@ type AdapterSetting struct {
 	OauthEndpoint      string
 	OpenIDMetadata     string
 	ChannelService     string
+	ChannelEnvironment *auth.ChannelEnvironment
 	CredentialProvider auth.CredentialProvider
+	TokenSource        auth.TokenSource
 	AuthClient         *http.Client
 	ReplyClient        *http.Client
+	RetryPolicy        client.RetryPolicy
+	RateLimiter        client.RateLimiter
+	Middleware         []Middleware
 }
 
 // BotFrameworkAdapter implements Adapter and is currently the only implementation returned to the user program.
@@ -63,21 +92,44 @@ type BotFrameworkAdapter struct {
 
 // NewBotAdapter creates and reuturns a new BotFrameworkAdapter with the specified AdapterSettings.
 func NewBotAdapter(settings AdapterSetting) (Adapter, error) {
-	// TODO: Support other credential providers - OpenID, MicrosoftApp, Government
-	settings.CredentialProvider = auth.SimpleCredentialProvider{
-		AppID:    settings.AppID,
-		Password: settings.AppPassword,
+	// Authenticate with AppID and AppPassword unless given other credentials, like a certificate
+	if settings.CredentialProvider == nil {
+		settings.CredentialProvider = auth.SimpleCredentialProvider{
+			AppID:    settings.AppID,
+			Password: settings.AppPassword,
+		}
+	}
+
+	if settings.ChannelEnvironment == nil {
+		environment, err := auth.ChannelEnvironmentForService(settings.ChannelService)
+		if err != nil {
+			return nil, err
+		}
+		settings.ChannelEnvironment = &environment
 	}
+	environment := *settings.ChannelEnvironment
 
-	if settings.ChannelService == "" {
-		settings.ChannelService = auth.ChannelService
+	if settings.ChannelAuthTenant == "" {
+		settings.ChannelAuthTenant = environment.ChannelAuthTenant
+	}
+
+	if settings.OauthEndpoint == "" {
+		settings.OauthEndpoint = environment.LoginEndpoint
+	}
+
+	if settings.OpenIDMetadata != "" {
+		environment.OpenIDMetadataURL = settings.OpenIDMetadata
 	}
 
 	// Prepare new config and Client
-	clientConfig, err := client.NewClientConfig(settings.CredentialProvider, auth.ToChannelFromBotLoginURL[0])
+	tokenURL := auth.ToChannelFromBotTokenURL(settings.OauthEndpoint, settings.ChannelAuthTenant)
+	clientConfig, err := client.NewClientConfig(settings.CredentialProvider, tokenURL)
 	if err != nil {
 		return nil, err
 	}
+	clientConfig.ChannelAuthTenant = settings.ChannelAuthTenant
+	clientConfig.OAuthEndpoint = settings.OauthEndpoint
+	clientConfig.OAuthScope = environment.OAuthScope
 
 	if settings.AuthClient != nil {
 		clientConfig.AuthClient = settings.AuthClient
@@ -87,40 +139,162 @@ func NewBotAdapter(settings AdapterSetting) (Adapter, error) {
 		clientConfig.ReplyClient = settings.ReplyClient
 	}
 
+	clientConfig.TokenSource = tokenSourceWithClient(settings.TokenSource, settings.AuthClient)
+	clientConfig.RetryPolicy = settings.RetryPolicy
+	if clientConfig.RetryPolicy == nil {
+		clientConfig.RetryPolicy = client.DefaultRetryPolicy()
+	}
+	clientConfig.RateLimiter = settings.RateLimiter
+
 	connectorClient, err := client.NewClient(clientConfig)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create Connector Client.")
 	}
 
-	return &BotFrameworkAdapter{settings, auth.NewJwtTokenValidator(), connectorClient}, nil
+	validatorOptions := []auth.ValidatorOption{auth.WithChannelEnvironment(environment)}
+	if settings.AuthClient != nil {
+		validatorOptions = append(validatorOptions, auth.WithHTTPClient(settings.AuthClient))
+	}
+	tokenValidator := auth.NewJwtTokenValidator(validatorOptions...)
+	return &BotFrameworkAdapter{AdapterSetting: settings, TokenValidator: tokenValidator, Client: connectorClient}, nil
+}
+
+// tokenSourceWithClient returns a copy of the token sources of package auth using the httpClient, unless
+// their HTTPClient is set. Other token sources are returned unchanged.
+func tokenSourceWithClient(source auth.TokenSource, httpClient *http.Client) auth.TokenSource {
+	if httpClient == nil {
+		return source
+	}
+	switch ts := source.(type) {
+	case *auth.ClientCredentialsTokenSource:
+		if ts.HTTPClient == nil {
+			withClient := *ts
+			withClient.HTTPClient = httpClient
+			return &withClient
+		}
+	case *auth.FederatedTokenSource:
+		if ts.HTTPClient == nil {
+			withClient := *ts
+			withClient.HTTPClient = httpClient
+			return &withClient
+		}
+	case *auth.ManagedIdentityTokenSource:
+		if ts.HTTPClient == nil {
+			withClient := *ts
+			withClient.HTTPClient = httpClient
+			return &withClient
+		}
+	}
+	return source
+}
+
+// Use adds middleware to the Middleware of the AdapterSetting. It is meant to be called while setting up
+// the adapter, before processing activities.
+func (bf *BotFrameworkAdapter) Use(middleware ...Middleware) *BotFrameworkAdapter {
+	bf.Middleware = append(bf.Middleware, middleware...)
+	return bf
 }
 
 // ProcessActivity receives an activity, processes it as specified in by the 'handler' and
 // sends it to the connector service.
+//
+// The turn is first passed through the Middleware of the AdapterSetting, which may short-circuit it
+// before the handler is called. The handler gets the context passed along by the middleware from
+// TurnContext.Context. The handler may send further activities during the turn using the
+// TurnContext, which is bound to the connector client of the adapter.
 func (bf *BotFrameworkAdapter) ProcessActivity(ctx context.Context, req schema.Activity, handler activity.Handler) error {
-	turnContext := &activity.TurnContext{
-		Activity: req,
+	_, err := bf.processActivity(ctx, req, handler)
+	return err
+}
+
+// ServeActivity processes the activity like ProcessActivity and writes the HTTP reply expected by the
+// connector service to w.
+//
+// For an 'invoke' activity the reply carries the status and JSON body of the InvokeResponse provided
+// by the handler, or 501 Not Implemented if the handler does not handle invoke activities.
+// Other activities are answered with 200 OK, or 202 Accepted if the turn did not send any activity
+// or the handler does not handle them.
+// Nothing is written to w if an error is returned.
+func (bf *BotFrameworkAdapter) ServeActivity(ctx context.Context, w http.ResponseWriter, req schema.Activity, handler activity.Handler) error {
+	turnContext, err := bf.processActivity(ctx, req, handler)
+	if req.Type != schema.Invoke {
+		if err != nil && !errors.Is(err, activity.ErrNotHandled) {
+			return err
+		}
+		if err != nil || !turnContext.Responded() {
+			w.WriteHeader(http.StatusAccepted)
+			return nil
+		}
+		w.WriteHeader(http.StatusOK)
+		return nil
 	}
 
-	replyActivity, err := activity.PrepareActivityContext(handler, turnContext)
+	if errors.Is(err, activity.ErrNotHandled) {
+		return writeInvokeResponse(w, activity.InvokeResponse{Status: http.StatusNotImplemented})
+	}
 	if err != nil {
-		return errors.Wrap(err, "Failed to create Activity context.")
+		return err
+	}
+	invokeResponse, ok := turnContext.InvokeResponse()
+	if !ok {
+		// Handled by OnInvoke, which sent its reply as an activity
+		invokeResponse = activity.InvokeResponse{Status: http.StatusOK}
 	}
+	return writeInvokeResponse(w, invokeResponse)
+}
 
-	response, err := activity.NewActivityResponse(bf.Client)
-	if err != nil {
-		return errors.Wrap(err, "Failed to create response object.")
+func (bf *BotFrameworkAdapter) processActivity(ctx context.Context, req schema.Activity, handler activity.Handler) (*activity.TurnContext, error) {
+	turnContext := activity.NewTurnContext(req, bf.Client)
+	turnContext.SetContext(ctx)
+
+	err := runMiddleware(ctx, bf.Middleware, turnContext, func(ctx context.Context) error {
+		turnContext.SetContext(ctx)
+		replyActivity, err := activity.PrepareActivityContext(handler, turnContext)
+		if err != nil {
+			return errors.Wrap(err, "Failed to create Activity context.")
+		}
+
+		// Nothing to send if the handler ignored the activity
+		if replyActivity.Type == "" {
+			return nil
+		}
+
+		_, err = turnContext.SendActivities(ctx, []schema.Activity{replyActivity})
+		return err
+	})
+	return turnContext, err
+}
+
+func writeInvokeResponse(w http.ResponseWriter, invokeResponse activity.InvokeResponse) error {
+	status := invokeResponse.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if invokeResponse.Body == nil {
+		w.WriteHeader(status)
+		return nil
 	}
 
-	return response.SendActivity(ctx, replyActivity)
+	body, err := json.Marshal(invokeResponse.Body)
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode invoke response.")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, err = w.Write(body)
+	return err
 }
 
 // ProactiveMessage sends activity to a conversation.
 // This methods is used for Bot initiated conversation.
+//
+// The turn is passed through the Middleware like the turns of received activities, so that e.g. the
+// state of the conversation is loaded and saved.
 func (bf *BotFrameworkAdapter) ProactiveMessage(ctx context.Context, ref schema.ConversationReference, handler activity.Handler) error {
 	// Prepare activity with conversation reference
 	activity := activity.ApplyConversationReference(schema.Activity{Type: schema.Message}, ref, true)
-	return bf.ProcessActivity(ctx, activity, handler)
+	_, err := bf.processActivity(ctx, activity, handler)
+	return err
 }
 
 // DeleteActivity Deletes an existing activity by Activity ID
@@ -143,21 +317,30 @@ func (bf *BotFrameworkAdapter) DeleteActivity(ctx context.Context, activityID st
 //
 // 2. Authenticate the request (using authenticateRequest())
 //
-// Returns an Activity value on successfull parsing.
+// Returns an Activity value on successfull parsing. Errors match ErrUnauthorized, ErrBadRequest or
+// ErrAuthenticationUnavailable.
 func (bf *BotFrameworkAdapter) ParseRequest(ctx context.Context, req *http.Request) (schema.Activity, error) {
 	activity := schema.Activity{}
 	// Find auth headers
 	authHeader := req.Header.Get("Authorization")
 	if len(authHeader) == 0 {
-		return activity, errors.New("Authentication headers are missing in the request")
+		return activity, requestError{ErrUnauthorized, errors.New("Authentication headers are missing in the request")}
 	}
 
 	// Parse request body
 	err := json.NewDecoder(req.Body).Decode(&activity)
 	if err != nil {
-		return activity, errors.Wrap(err, "Error while parsing Bot request")
+		return activity, requestError{ErrBadRequest, errors.Wrap(err, "Error while parsing Bot request")}
+	}
+
+	err = bf.authenticateRequest(ctx, activity, authHeader)
+	if err != nil {
+		if !auth.IsValidationError(err) {
+			return activity, requestError{ErrAuthenticationUnavailable, err}
+		}
+		return activity, requestError{ErrUnauthorized, err}
 	}
-	return activity, bf.authenticateRequest(ctx, activity, authHeader)
+	return activity, nil
 }
 
 func (bf *BotFrameworkAdapter) authenticateRequest(ctx context.Context, req schema.Activity, headers string) error {
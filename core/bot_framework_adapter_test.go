@@ -39,6 +39,7 @@ import (
 
 func serverMock(t *testing.T) *httptest.Server {
 	handler := http.NewServeMux()
+	handler.HandleFunc("/oauth2/v2.0/token", tokenMock)
 	handler.HandleFunc("/v3/conversations/abcd1234/activities", msTeamsMockMock)
 	h1 := &msTeamsActivityUpdateMock{t: t}
 	handler.Handle("/v3/conversations/TestActivityUpdate/activities", h1)
@@ -47,6 +48,10 @@ func serverMock(t *testing.T) *httptest.Server {
 	return srv
 }
 
+func tokenMock(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("{\"token_type\":\"Bearer\",\"expires_in\":3600,\"access_token\":\"abc123\"}"))
+}
+
 func msTeamsMockMock(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte("{\"id\":\"1\"}"))
 }
@@ -64,6 +69,23 @@ func (th *msTeamsActivityUpdateMock) ServeHTTP(w http.ResponseWriter, r *http.Re
 	_, _ = w.Write([]byte("{\"id\":\"1\"}"))
 }
 
+// newTestAdapter creates an adapter which skips authentication and talks to the mock server.
+func newTestAdapter(t *testing.T, srv *httptest.Server) *core.BotFrameworkAdapter {
+	setting := core.AdapterSetting{
+		AppID:       "asdasd",
+		AppPassword: "cfg.MicrosoftTeams.AppPassword",
+	}
+	setting.CredentialProvider = auth.SimpleCredentialProvider{
+		AppID:    setting.AppID,
+		Password: setting.AppPassword,
+	}
+	clientConfig, err := client.NewClientConfig(setting.CredentialProvider, srv.URL+"/oauth2/v2.0/token")
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	connectorClient, err := client.NewClient(clientConfig)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	return &core.BotFrameworkAdapter{setting, &core.MockTokenValidator{}, connectorClient}
+}
+
 // Create a handler that defines operations to be performed on respective events.
 // Following defines the operation to be performed on the 'message' event.
 var customHandler = activity.HandlerFuncs{
@@ -104,7 +126,7 @@ func TestExample(t *testing.T) {
 			AppID:    setting.AppID,
 			Password: setting.AppPassword,
 		}
-		clientConfig, err := client.NewClientConfig(setting.CredentialProvider, auth.ToChannelFromBotLoginURL[0])
+		clientConfig, err := client.NewClientConfig(setting.CredentialProvider, srv.URL+"/oauth2/v2.0/token")
 		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
 		connectorClient, err := client.NewClient(clientConfig)
 		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
@@ -157,7 +179,7 @@ func TestActivityUpdate(t *testing.T) {
 			AppID:    setting.AppID,
 			Password: setting.AppPassword,
 		}
-		clientConfig, err := client.NewClientConfig(setting.CredentialProvider, auth.ToChannelFromBotLoginURL[0])
+		clientConfig, err := client.NewClientConfig(setting.CredentialProvider, srv.URL+"/oauth2/v2.0/token")
 		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
 		connectorClient, err := client.NewClient(clientConfig)
 		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
@@ -177,3 +199,284 @@ func TestActivityUpdate(t *testing.T) {
 	handler.ServeHTTP(rr, req)
 	assert.Equal(t, rr.Code, 200, "Expect 200 response status")
 }
+
+func TestActivityResponseEscapeIDs(t *testing.T) {
+	var requests []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/v2.0/token", tokenMock)
+	mux.HandleFunc("/v3/conversations/", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.RequestURI)
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	response := &activity.DefaultResponse{Client: newTestAdapter(t, srv).Client}
+	act := schema.Activity{
+		Type:         schema.Message,
+		ID:           "1:5d5cdc723",
+		Conversation: schema.ConversationAccount{ID: "19:abcd/ef@thread.v2;messageid=1234"},
+		ServiceURL:   srv.URL,
+	}
+	ctx := context.Background()
+	_, err := response.SendActivityWithResponse(ctx, act)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	_, err = response.UpdateActivityWithResponse(ctx, act)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	err = response.DeleteActivity(ctx, act)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	assert.Equal(t, []string{
+		"POST /v3/conversations/19:abcd%2Fef@thread.v2%3Bmessageid=1234/activities",
+		"PUT /v3/conversations/19:abcd%2Fef@thread.v2%3Bmessageid=1234/activities/1:5d5cdc723",
+		"DELETE /v3/conversations/19:abcd%2Fef@thread.v2%3Bmessageid=1234/activities/1:5d5cdc723",
+	}, requests, "Expect each ID escaped as one path segment")
+}
+
+func TestActivityTypeRouting(t *testing.T) {
+	srv := serverMock(t)
+	adapter := newTestAdapter(t, srv)
+
+	var events []string
+	handler := activity.HandlerFuncs{
+		OnEventFunc: func(turn *activity.TurnContext) (schema.Activity, error) {
+			events = append(events, turn.Activity.Name)
+			return turn.SendActivity(activity.MsgOptionText("Event: " + turn.Activity.Name))
+		},
+	}
+
+	act := schema.Activity{
+		Type:         schema.Event,
+		Name:         "TestEvent",
+		Conversation: schema.ConversationAccount{ID: "abcd1234"},
+		ServiceURL:   srv.URL,
+	}
+	err := adapter.ProcessActivity(context.Background(), act, handler)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, []string{"TestEvent"}, events, "Expect event to be routed to OnEventFunc")
+
+	// Activity types without a handler function are ignored
+	for _, tpe := range []schema.ActivityTypes{schema.Typing, schema.EndOfConversation, schema.InstallationUpdate, "unknown"} {
+		act.Type = tpe
+		err = adapter.ProcessActivity(context.Background(), act, handler)
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	}
+	assert.Equal(t, 1, len(events), "Expect only the event activity to be handled")
+}
+
+func TestConversationUpdateSubHandlers(t *testing.T) {
+	var added []schema.ChannelAccount
+	var reactions []schema.MessageReaction
+	handler := activity.HandlerFuncs{
+		OnMembersAddedFunc: func(members []schema.ChannelAccount, turn *activity.TurnContext) (schema.Activity, error) {
+			added = members
+			return schema.Activity{}, nil
+		},
+		OnReactionsAddedFunc: func(r []schema.MessageReaction, turn *activity.TurnContext) (schema.Activity, error) {
+			reactions = r
+			return schema.Activity{}, nil
+		},
+	}
+
+	bot := schema.ChannelAccount{ID: "1234abcd", Name: "SteveW"}
+	user := schema.ChannelAccount{ID: "12345678", Name: "Pepper's News Feed"}
+	turn := &activity.TurnContext{
+		Activity: schema.Activity{
+			Type:         schema.ConversationUpdate,
+			Recipient:    bot,
+			MembersAdded: []schema.ChannelAccount{bot, user},
+		},
+	}
+	_, err := activity.PrepareActivityContext(handler, turn)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, []schema.ChannelAccount{user}, added, "Expect bot to be excluded from added members")
+
+	// Only the bot was added, nothing to report
+	added = nil
+	turn.Activity.MembersAdded = []schema.ChannelAccount{bot}
+	_, err = activity.PrepareActivityContext(handler, turn)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Nil(t, added, "Expect OnMembersAddedFunc not to be called")
+
+	turn.Activity = schema.Activity{
+		Type:           schema.MsgReaction,
+		ReactionsAdded: []schema.MessageReaction{{Type: schema.Like}},
+	}
+	_, err = activity.PrepareActivityContext(handler, turn)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, []schema.MessageReaction{{Type: schema.Like}}, reactions, "Expect reactions to be passed to OnReactionsAddedFunc")
+}
+
+func TestSubHandlersNotHandled(t *testing.T) {
+	for _, act := range []schema.Activity{
+		{Type: schema.ConversationUpdate, MembersAdded: []schema.ChannelAccount{{ID: "new-user"}}},
+		{Type: schema.MsgReaction, ReactionsAdded: []schema.MessageReaction{{Type: schema.Like}}},
+	} {
+		_, err := activity.PrepareActivityContext(activity.HandlerFuncs{}, &activity.TurnContext{Activity: act})
+		assert.ErrorIs(t, err, activity.ErrNotHandled, fmt.Sprintf("Expect %s without handler functions not to be handled", act.Type))
+	}
+}
+
+func TestSubHandlersBothLists(t *testing.T) {
+	var calls []string
+	reply := func(text string) (schema.Activity, error) {
+		calls = append(calls, text)
+		return schema.Activity{Type: schema.Message, Text: text}, nil
+	}
+	handler := activity.HandlerFuncs{
+		OnMembersAddedFunc: func(members []schema.ChannelAccount, turn *activity.TurnContext) (schema.Activity, error) {
+			return reply("added " + members[0].ID)
+		},
+		OnMembersRemovedFunc: func(members []schema.ChannelAccount, turn *activity.TurnContext) (schema.Activity, error) {
+			return reply("removed " + members[0].ID)
+		},
+		OnReactionsAddedFunc: func(reactions []schema.MessageReaction, turn *activity.TurnContext) (schema.Activity, error) {
+			return reply("added " + string(reactions[0].Type))
+		},
+		OnReactionsRemovedFunc: func(reactions []schema.MessageReaction, turn *activity.TurnContext) (schema.Activity, error) {
+			return reply("removed " + string(reactions[0].Type))
+		},
+	}
+
+	for _, test := range []struct {
+		name     string
+		activity schema.Activity
+		calls    []string
+	}{
+		{
+			name: "Members added and removed",
+			activity: schema.Activity{
+				Type:           schema.ConversationUpdate,
+				MembersAdded:   []schema.ChannelAccount{{ID: "new-user"}},
+				MembersRemoved: []schema.ChannelAccount{{ID: "old-user"}},
+			},
+			calls: []string{"added new-user", "removed old-user"},
+		},
+		{
+			name: "Reactions added and removed",
+			activity: schema.Activity{
+				Type:             schema.MsgReaction,
+				ReactionsAdded:   []schema.MessageReaction{{Type: schema.Like}},
+				ReactionsRemoved: []schema.MessageReaction{{Type: schema.PlusOne}},
+			},
+			calls: []string{"added like", "removed plusOne"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			calls = nil
+			var sent []string
+			turn := activity.NewTurnContext(test.activity, nil)
+			turn.OnSendActivities(func(ctx context.Context, turn *activity.TurnContext, activities []schema.Activity, next activity.SendActivitiesFunc) ([]schema.ResourceResponse, error) {
+				for _, act := range activities {
+					sent = append(sent, act.Text)
+				}
+				return make([]schema.ResourceResponse, len(activities)), nil
+			})
+
+			replyActivity, err := activity.PrepareActivityContext(handler, turn)
+			assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+			assert.Equal(t, test.calls, calls, "Expect both lists to be dispatched")
+			assert.Equal(t, test.calls[:1], sent, "Expect the first reply to be sent right away")
+			assert.Equal(t, test.calls[1], replyActivity.Text, "Expect the second reply to be returned")
+		})
+	}
+}
+
+func TestSendActivitiesDuringTurn(t *testing.T) {
+	srv := serverMock(t)
+	adapter := newTestAdapter(t, srv)
+
+	var responses []schema.ResourceResponse
+	handler := activity.HandlerFuncs{
+		OnMessageFunc: func(turn *activity.TurnContext) (schema.Activity, error) {
+			reply, err := turn.SendActivity(activity.MsgOptionText("Echo: " + turn.Activity.Text))
+			if err != nil {
+				return schema.Activity{}, err
+			}
+			responses, err = turn.SendActivities(context.Background(), []schema.Activity{{Type: schema.Typing}, reply})
+			if err != nil {
+				return schema.Activity{}, err
+			}
+			assert.True(t, turn.Responded(), "Expect turn to have responded")
+			return schema.Activity{}, nil
+		},
+	}
+
+	act := schema.Activity{
+		Type:         schema.Message,
+		Text:         "Message from Teams Client",
+		Conversation: schema.ConversationAccount{ID: "abcd1234"},
+		ServiceURL:   srv.URL,
+	}
+	err := adapter.ProcessActivity(context.Background(), act, handler)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, []schema.ResourceResponse{{ID: "1"}, {ID: "1"}}, responses, "Expect a resource response per activity")
+
+	// A TurnContext without connector client can only build activities
+	_, err = (&activity.TurnContext{Activity: act}).SendActivities(context.Background(), []schema.Activity{{Type: schema.Typing}})
+	assert.NotNil(t, err, "Expect error for unbound TurnContext")
+}
+
+func TestServeInvokeActivity(t *testing.T) {
+	srv := serverMock(t)
+	adapter := newTestAdapter(t, srv)
+
+	act := schema.Activity{
+		Type:         schema.Invoke,
+		Name:         "task/fetch",
+		Conversation: schema.ConversationAccount{ID: "abcd1234"},
+		ServiceURL:   srv.URL,
+	}
+	handler := activity.HandlerFuncs{
+		OnInvokeActivityFunc: func(turn *activity.TurnContext) (activity.InvokeResponse, error) {
+			return activity.InvokeResponse{
+				Status: http.StatusOK,
+				Body:   map[string]interface{}{"task": map[string]interface{}{"type": "message", "value": turn.Activity.Name}},
+			}, nil
+		},
+	}
+	rr := httptest.NewRecorder()
+	err := adapter.ServeActivity(context.Background(), rr, act, handler)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, http.StatusOK, rr.Code, "Expect 200 response status")
+	assert.JSONEq(t, `{"task":{"type":"message","value":"task/fetch"}}`, rr.Body.String(), "Expect invoke response body")
+
+	// Invoke activities without handler are not implemented
+	rr = httptest.NewRecorder()
+	err = adapter.ServeActivity(context.Background(), rr, act, activity.HandlerFuncs{})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, http.StatusNotImplemented, rr.Code, "Expect 501 response status")
+}
+
+func TestNewBotAdapterRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   client.RetryPolicy
+		expected client.RetryPolicy
+	}{
+		{"default", nil, client.DefaultRetryPolicy()},
+		{"disabled", client.NoRetry{}, client.NoRetry{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			adapter, err := core.NewBotAdapter(core.AdapterSetting{AppID: "asdasd", AppPassword: "secret", RetryPolicy: test.policy})
+			assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+			connectorClient := adapter.(*core.BotFrameworkAdapter).Client.(*client.ConnectorClient)
+			assert.Equal(t, test.expected, connectorClient.RetryPolicy, "Unexpected retry policy")
+		})
+	}
+}
+
+func TestNewBotAdapterTokenSourceClient(t *testing.T) {
+	authClient := &http.Client{}
+	source := auth.NewClientSecretTokenSource("asdasd", "secret")
+	adapter, err := core.NewBotAdapter(core.AdapterSetting{AppID: "asdasd", TokenSource: source, AuthClient: authClient})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	connectorClient := adapter.(*core.BotFrameworkAdapter).Client.(*client.ConnectorClient)
+	tokenSource, ok := connectorClient.TokenSource.(*auth.ClientCredentialsTokenSource)
+	assert.True(t, ok, "Expect a client credentials token source")
+	assert.Equal(t, authClient, tokenSource.HTTPClient, "Expect token requests sent with the AuthClient")
+	assert.Nil(t, source.HTTPClient, "Expect the configured token source unchanged")
+}
@@ -21,6 +21,7 @@
 Package core is the entry point and the main interface for a user program.
 
 It provides an adapter to the user program using which all the operations can be made on this SDK.
+The Middleware of the AdapterSetting runs for every turn, before the handler of the activity.
 See the example to understand how to use this package to perform operations on the Bot Framwework connector service.
 */
 package core
@@ -0,0 +1,57 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package core
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnauthorized is matched, using errors.Is, by the errors returned by ParseRequest
+	// when the request fails authentication.
+	ErrUnauthorized = errors.New("Unauthorized request")
+
+	// ErrBadRequest is matched, using errors.Is, by the errors returned by ParseRequest
+	// when the request body is not a valid activity.
+	ErrBadRequest = errors.New("Bad request")
+
+	// ErrAuthenticationUnavailable is matched, using errors.Is, by the errors returned by ParseRequest
+	// when the request could not be authenticated for a reason other than an invalid token, like a
+	// failure to fetch the OpenID metadata or signing keys.
+	ErrAuthenticationUnavailable = errors.New("Authentication unavailable")
+)
+
+// requestError classifies an error with one of the sentinel errors above, keeping its message.
+type requestError struct {
+	kind error
+	err  error
+}
+
+func (re requestError) Error() string {
+	return re.err.Error()
+}
+
+func (re requestError) Unwrap() error {
+	return re.err
+}
+
+func (re requestError) Is(target error) bool {
+	return target == re.kind
+}
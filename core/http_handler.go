@@ -0,0 +1,178 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/infracloudio/msbotbuilder-go/connector/auth"
+	"github.com/infracloudio/msbotbuilder-go/core/activity"
+	"github.com/infracloudio/msbotbuilder-go/schema/customerror"
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxRequestBytes is the default limit for the size of a request body accepted by the handler
+// returned by NewHTTPHandler.
+const DefaultMaxRequestBytes = 4 << 20
+
+// HTTPHandlerOption option provided when creating a handler with NewHTTPHandler.
+type HTTPHandlerOption func(*httpHandler)
+
+// HTTPOptionMaxRequestBytes limits the size of the request body accepted by the handler.
+// Larger requests are rejected with 413 Request Entity Too Large.
+func HTTPOptionMaxRequestBytes(n int64) HTTPHandlerOption {
+	return func(h *httpHandler) {
+		h.maxRequestBytes = n
+	}
+}
+
+// HTTPOptionErrorHandler sets a function called with every error which fails a request,
+// e.g. for logging. The HTTP reply has already been written when it is called.
+func HTTPOptionErrorHandler(fn func(req *http.Request, err error)) HTTPHandlerOption {
+	return func(h *httpHandler) {
+		h.onError = fn
+	}
+}
+
+type httpHandler struct {
+	adapter         Adapter
+	handler         activity.Handler
+	maxRequestBytes int64
+	onError         func(req *http.Request, err error)
+}
+
+// NewHTTPHandler returns a http.Handler serving the Bot Framework messaging endpoint.
+//
+// Every request is parsed and authenticated with the adapter, then processed by the handler.
+// Failures are answered with:
+//
+// 401 Unauthorized if the request fails authentication, with a WWW-Authenticate header telling why
+// an invalid token was rejected.
+//
+// 400 Bad Request if the body is not a valid activity.
+//
+// 503 Service Unavailable if the request could not be authenticated for a reason other than an invalid
+// token, like a failure to fetch the signing keys, so that the channel retries it.
+//
+// 413 Request Entity Too Large if the body exceeds the size limit.
+//
+// 502 Bad Gateway if a call to the connector service fails.
+//
+// 500 Internal Server Error for any other error returned by the handler.
+//
+// Successful requests are answered as described for BotFrameworkAdapter.ServeActivity if the adapter
+// implements ActivityServer, or with 200 OK after Adapter.ProcessActivity otherwise.
+func NewHTTPHandler(adapter Adapter, handler activity.Handler, options ...HTTPHandlerOption) http.Handler {
+	h := &httpHandler{
+		adapter:         adapter,
+		handler:         handler,
+		maxRequestBytes: DefaultMaxRequestBytes,
+	}
+	for _, opt := range options {
+		opt(h)
+	}
+	return h
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.fail(w, req, http.StatusMethodNotAllowed, errors.Errorf("Method %s not allowed", req.Method))
+		return
+	}
+
+	// Read one byte more than allowed to detect oversized requests
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, h.maxRequestBytes+1))
+	if err != nil {
+		h.fail(w, req, http.StatusBadRequest, errors.Wrap(err, "Failed to read request body"))
+		return
+	}
+	if int64(len(body)) > h.maxRequestBytes {
+		h.fail(w, req, http.StatusRequestEntityTooLarge, errors.Errorf("Request body exceeds %d bytes", h.maxRequestBytes))
+		return
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	ctx := req.Context()
+	act, err := h.adapter.ParseRequest(ctx, req)
+	if err != nil {
+		status := http.StatusUnauthorized
+		switch {
+		case errors.Is(err, ErrBadRequest):
+			status = http.StatusBadRequest
+		case errors.Is(err, ErrAuthenticationUnavailable):
+			status = http.StatusServiceUnavailable
+		default:
+			w.Header().Set("WWW-Authenticate", authenticateChallenge(err))
+		}
+		h.fail(w, req, status, err)
+		return
+	}
+
+	if server, ok := h.adapter.(ActivityServer); ok {
+		err = server.ServeActivity(ctx, w, act, h.handler)
+	} else if err = h.adapter.ProcessActivity(ctx, act, h.handler); err == nil {
+		w.WriteHeader(http.StatusOK)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.As(err, &customerror.HTTPError{}) {
+			status = http.StatusBadGateway
+		}
+		h.fail(w, req, status, err)
+	}
+}
+
+// tokenErrorDescriptions describe why a token was rejected, by auth sentinel error.
+var tokenErrorDescriptions = []struct {
+	kind        error
+	description string
+}{
+	{auth.ErrTokenExpired, "The token expired"},
+	{auth.ErrTokenNotValidYet, "The token is not valid yet"},
+	{auth.ErrInvalidSignature, "The token signature is invalid"},
+	{auth.ErrInvalidAlgorithm, "The token signing algorithm is not allowed"},
+	{auth.ErrInvalidIssuer, "The token issuer is invalid"},
+	{auth.ErrInvalidAudience, "The token audience is invalid"},
+	{auth.ErrInvalidServiceURL, "The token service URL is invalid"},
+	{auth.ErrKeyNotEndorsed, "The token signing key is not endorsed for the channel"},
+}
+
+// authenticateChallenge returns the WWW-Authenticate header for a request rejected with err, as described by
+// RFC 6750. The reason is only given for invalid tokens.
+func authenticateChallenge(err error) string {
+	for _, tokenErr := range tokenErrorDescriptions {
+		if errors.Is(err, tokenErr.kind) {
+			return fmt.Sprintf(`Bearer error="invalid_token", error_description="%s"`, tokenErr.description)
+		}
+	}
+	return "Bearer"
+}
+
+func (h *httpHandler) fail(w http.ResponseWriter, req *http.Request, status int, err error) {
+	http.Error(w, http.StatusText(status), status)
+	if h.onError != nil {
+		h.onError(req, err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package core_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/infracloudio/msbotbuilder-go/connector/auth"
+	"github.com/infracloudio/msbotbuilder-go/core"
+	"github.com/infracloudio/msbotbuilder-go/core/activity"
+	"github.com/infracloudio/msbotbuilder-go/schema"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type rejectingTokenValidator struct{}
+
+func (rejectingTokenValidator) AuthenticateRequest(ctx context.Context, activity schema.Activity, authHeader string, credentials auth.CredentialProvider, channelService string) (auth.ClaimsIdentity, error) {
+	return nil, fmt.Errorf("Unauthorized Access. Request is not authorized: %w", auth.ErrInvalidSignature)
+}
+
+type unavailableTokenValidator struct{}
+
+func (unavailableTokenValidator) AuthenticateRequest(ctx context.Context, activity schema.Activity, authHeader string, credentials auth.CredentialProvider, channelService string) (auth.ClaimsIdentity, error) {
+	return nil, errors.New("Failed to fetch OpenID metadata")
+}
+
+// processingAdapter implements only the methods of core.Adapter, like adapters written before core.ActivityServer.
+type processingAdapter struct {
+	core.Adapter
+}
+
+func TestHTTPHandler(t *testing.T) {
+	srv := serverMock(t)
+	adapter := newTestAdapter(t, srv)
+
+	handler := activity.HandlerFuncs{
+		OnMessageFunc: func(turn *activity.TurnContext) (schema.Activity, error) {
+			return turn.SendActivity(activity.MsgOptionText("Echo: " + turn.Activity.Text))
+		},
+		OnInvokeActivityFunc: func(turn *activity.TurnContext) (activity.InvokeResponse, error) {
+			return activity.InvokeResponse{Status: http.StatusConflict}, nil
+		},
+	}
+	message := `{"type":"message","text":"Hi","conversation":{"id":"abcd1234"},"serviceUrl":"` + srv.URL + `"}`
+
+	tests := []struct {
+		name       string
+		adapter    core.Adapter
+		body       string
+		authHeader string
+		status     int
+	}{
+		{"message", adapter, message, "Bearer abc123", http.StatusOK},
+		{"ignored activity", adapter, `{"type":"typing","conversation":{"id":"abcd1234"},"serviceUrl":"` + srv.URL + `"}`, "Bearer abc123", http.StatusAccepted},
+		{"unhandled conversation update", adapter, `{"type":"conversationUpdate","membersAdded":[{"id":"user1"}],"conversation":{"id":"abcd1234"},"serviceUrl":"` + srv.URL + `"}`, "Bearer abc123", http.StatusAccepted},
+		{"invoke", adapter, `{"type":"invoke","conversation":{"id":"abcd1234"},"serviceUrl":"` + srv.URL + `"}`, "Bearer abc123", http.StatusConflict},
+		{"missing auth header", adapter, message, "", http.StatusUnauthorized},
+		{"authentication failure", &core.BotFrameworkAdapter{adapter.AdapterSetting, rejectingTokenValidator{}, adapter.Client}, message, "Bearer abc123", http.StatusUnauthorized},
+		{"authentication unavailable", &core.BotFrameworkAdapter{adapter.AdapterSetting, unavailableTokenValidator{}, adapter.Client}, message, "Bearer abc123", http.StatusServiceUnavailable},
+		{"malformed JSON", adapter, `{"type":`, "Bearer abc123", http.StatusBadRequest},
+		{"too large", adapter, `{"type":"message","text":"` + strings.Repeat("a", 1024) + `"}`, "Bearer abc123", http.StatusRequestEntityTooLarge},
+		{"adapter without ServeActivity", processingAdapter{adapter}, `{"type":"typing","conversation":{"id":"abcd1234"},"serviceUrl":"` + srv.URL + `"}`, "Bearer abc123", http.StatusOK},
+		{"connector failure", adapter, `{"type":"message","conversation":{"id":"unknown"},"serviceUrl":"` + srv.URL + `"}`, "Bearer abc123", http.StatusBadGateway},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/messages", bytes.NewBufferString(test.body))
+			if test.authHeader != "" {
+				req.Header.Set("Authorization", test.authHeader)
+			}
+			rr := httptest.NewRecorder()
+			core.NewHTTPHandler(test.adapter, handler, core.HTTPOptionMaxRequestBytes(512)).ServeHTTP(rr, req)
+			assert.Equal(t, test.status, rr.Code, "Unexpected response status")
+		})
+	}
+}
+
+type expiredTokenValidator struct{}
+
+func (expiredTokenValidator) AuthenticateRequest(ctx context.Context, activity schema.Activity, authHeader string, credentials auth.CredentialProvider, channelService string) (auth.ClaimsIdentity, error) {
+	return nil, fmt.Errorf("Token validation failed: %w", auth.ErrTokenExpired)
+}
+
+func TestHTTPHandlerAuthenticateChallenge(t *testing.T) {
+	srv := serverMock(t)
+	adapter := newTestAdapter(t, srv)
+	message := `{"type":"message","text":"hello"}`
+
+	tests := []struct {
+		name       string
+		adapter    core.Adapter
+		authHeader string
+		challenge  string
+	}{
+		{"missing token", adapter, "", "Bearer"},
+		{"expired token", &core.BotFrameworkAdapter{adapter.AdapterSetting, expiredTokenValidator{}, adapter.Client}, "Bearer abc123", `Bearer error="invalid_token", error_description="The token expired"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/messages", bytes.NewBufferString(message))
+			if test.authHeader != "" {
+				req.Header.Set("Authorization", test.authHeader)
+			}
+			rr := httptest.NewRecorder()
+			core.NewHTTPHandler(test.adapter, activity.HandlerFuncs{}).ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusUnauthorized, rr.Code, "Unexpected response status")
+			assert.Equal(t, test.challenge, rr.Header().Get("WWW-Authenticate"), "Unexpected challenge")
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package core
+
+import (
+	"context"
+
+	"github.com/infracloudio/msbotbuilder-go/core/activity"
+)
+
+// NextFunc continues the turn with the next middleware, or the handler of the activity after the last one.
+type NextFunc func(ctx context.Context) error
+
+// Middleware is run by the adapter for each turn, before the handler of the activity, to implement
+// concerns common to all the activities like logging or loading state.
+//
+// OnTurn calls next to continue the turn and may act on the TurnContext after it returns. Not calling
+// next short-circuits the turn: the following middleware and the handler are not run.
+// Activities sent during the turn can be intercepted with the hooks of the TurnContext, like
+// TurnContext.OnSendActivities.
+type Middleware interface {
+	OnTurn(ctx context.Context, turn *activity.TurnContext, next NextFunc) error
+}
+
+// MiddlewareFunc is an adaptor to use an ordinary function as Middleware.
+type MiddlewareFunc func(ctx context.Context, turn *activity.TurnContext, next NextFunc) error
+
+// OnTurn calls f(ctx, turn, next).
+func (f MiddlewareFunc) OnTurn(ctx context.Context, turn *activity.TurnContext, next NextFunc) error {
+	return f(ctx, turn, next)
+}
+
+// runMiddleware runs the middleware in order, then handle as the last step of the turn.
+func runMiddleware(ctx context.Context, middleware []Middleware, turn *activity.TurnContext, handle NextFunc) error {
+	if len(middleware) == 0 {
+		return handle(ctx)
+	}
+	return middleware[0].OnTurn(ctx, turn, func(ctx context.Context) error {
+		return runMiddleware(ctx, middleware[1:], turn, handle)
+	})
+}
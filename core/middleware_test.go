@@ -0,0 +1,235 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package core_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/infracloudio/msbotbuilder-go/core"
+	"github.com/infracloudio/msbotbuilder-go/core/activity"
+	"github.com/infracloudio/msbotbuilder-go/schema"
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingMiddleware records the steps of the turn around the next middleware.
+func recordingMiddleware(name string, steps *[]string) core.Middleware {
+	return core.MiddlewareFunc(func(ctx context.Context, turn *activity.TurnContext, next core.NextFunc) error {
+		*steps = append(*steps, name+" before")
+		err := next(ctx)
+		*steps = append(*steps, name+" after")
+		return err
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	srv := serverMock(t)
+	act := schema.Activity{
+		Type:         schema.Message,
+		Text:         "Hello",
+		Conversation: schema.ConversationAccount{ID: "abcd1234"},
+		ServiceURL:   srv.URL,
+	}
+
+	var steps []string
+	handler := activity.HandlerFuncs{
+		OnMessageFunc: func(turn *activity.TurnContext) (schema.Activity, error) {
+			steps = append(steps, "handler")
+			return turn.SendActivity(activity.MsgOptionText("Echo: " + turn.Activity.Text))
+		},
+	}
+
+	for _, test := range []struct {
+		name       string
+		middleware []core.Middleware
+		err        error
+		steps      []string
+	}{
+		{
+			name: "Run in order",
+			middleware: []core.Middleware{
+				recordingMiddleware("first", &steps),
+				recordingMiddleware("second", &steps),
+			},
+			steps: []string{"first before", "second before", "handler", "second after", "first after"},
+		},
+		{
+			name: "Short-circuit",
+			middleware: []core.Middleware{
+				recordingMiddleware("first", &steps),
+				core.MiddlewareFunc(func(ctx context.Context, turn *activity.TurnContext, next core.NextFunc) error {
+					steps = append(steps, "short-circuit")
+					return nil
+				}),
+				recordingMiddleware("second", &steps),
+			},
+			steps: []string{"first before", "short-circuit", "first after"},
+		},
+		{
+			name: "Error",
+			middleware: []core.Middleware{
+				recordingMiddleware("first", &steps),
+				core.MiddlewareFunc(func(ctx context.Context, turn *activity.TurnContext, next core.NextFunc) error {
+					return errors.New("middleware failed")
+				}),
+			},
+			err:   errors.New("middleware failed"),
+			steps: []string{"first before", "first after"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			steps = nil
+			adapter := newTestAdapter(t, srv)
+			adapter.Use(test.middleware...)
+			err := adapter.ProcessActivity(context.Background(), act, handler)
+			if test.err != nil {
+				assert.EqualError(t, err, test.err.Error())
+			} else {
+				assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+			}
+			assert.Equal(t, test.steps, steps)
+		})
+	}
+}
+
+type contextKey struct{}
+
+func TestMiddlewareContext(t *testing.T) {
+	srv := serverMock(t)
+	act := schema.Activity{
+		Type:         schema.Message,
+		Text:         "Hello",
+		Conversation: schema.ConversationAccount{ID: "abcd1234"},
+		ServiceURL:   srv.URL,
+	}
+
+	var value interface{}
+	handler := activity.HandlerFuncs{
+		OnMessageFunc: func(turn *activity.TurnContext) (schema.Activity, error) {
+			value = turn.Context().Value(contextKey{})
+			return schema.Activity{}, nil
+		},
+	}
+	adapter := newTestAdapter(t, srv)
+	adapter.Use(core.MiddlewareFunc(func(ctx context.Context, turn *activity.TurnContext, next core.NextFunc) error {
+		return next(context.WithValue(ctx, contextKey{}, "from middleware"))
+	}))
+
+	err := adapter.ProcessActivity(context.Background(), act, handler)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, "from middleware", value, "Expect the handler to get the context passed to next")
+}
+
+func TestProactiveMessageMiddleware(t *testing.T) {
+	srv := serverMock(t)
+	var steps []string
+	handler := activity.HandlerFuncs{
+		OnMessageFunc: func(turn *activity.TurnContext) (schema.Activity, error) {
+			steps = append(steps, "handler")
+			return turn.SendActivity(activity.MsgOptionText("Hello"))
+		},
+	}
+	adapter := newTestAdapter(t, srv)
+	adapter.Use(recordingMiddleware("first", &steps))
+
+	ref := schema.ConversationReference{Conversation: schema.ConversationAccount{ID: "abcd1234"}, ServiceURL: srv.URL}
+	err := adapter.ProactiveMessage(context.Background(), ref, handler)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, []string{"first before", "handler", "first after"}, steps, "Expect proactive turns to run the middleware")
+}
+
+func TestMiddlewareSendActivitiesHook(t *testing.T) {
+	srv := serverMock(t)
+	act := schema.Activity{
+		Type:         schema.Message,
+		Text:         "Hello",
+		Conversation: schema.ConversationAccount{ID: "abcd1234"},
+		ServiceURL:   srv.URL,
+	}
+
+	var sent []schema.Activity
+	var responses []schema.ResourceResponse
+	adapter := newTestAdapter(t, srv)
+	adapter.Use(core.MiddlewareFunc(func(ctx context.Context, turn *activity.TurnContext, next core.NextFunc) error {
+		turn.OnSendActivities(
+			func(ctx context.Context, turn *activity.TurnContext, activities []schema.Activity, next activity.SendActivitiesFunc) ([]schema.ResourceResponse, error) {
+				for i := range activities {
+					activities[i].Text = "[bot] " + activities[i].Text
+				}
+				var err error
+				responses, err = next(ctx, activities)
+				return responses, err
+			},
+			func(ctx context.Context, turn *activity.TurnContext, activities []schema.Activity, next activity.SendActivitiesFunc) ([]schema.ResourceResponse, error) {
+				sent = append(sent, activities...)
+				return next(ctx, activities)
+			},
+		)
+		return next(ctx)
+	}))
+
+	err := adapter.ProcessActivity(context.Background(), act, customHandler)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, 1, len(sent), "Expect reply to be intercepted")
+	assert.Equal(t, "[bot] Echo: Hello", sent[0].Text, "Expect reply changed by the first hook")
+	assert.Equal(t, srv.URL, sent[0].ServiceURL, "Expect hooks to receive addressed activities")
+	assert.Equal(t, []schema.ResourceResponse{{ID: "1"}}, responses)
+}
+
+func TestTurnContextHooks(t *testing.T) {
+	ctx := context.Background()
+	turn := activity.NewTurnContext(schema.Activity{
+		Type:         schema.Message,
+		Conversation: schema.ConversationAccount{ID: "abcd1234"},
+		ServiceURL:   "https://smba.trafficmanager.net/amer/",
+	}, nil)
+
+	var updated []string
+	turn.OnUpdateActivity(func(ctx context.Context, turn *activity.TurnContext, act schema.Activity, next activity.UpdateActivityFunc) (schema.ResourceResponse, error) {
+		updated = append(updated, act.ID+" "+act.Conversation.ID)
+		return schema.ResourceResponse{ID: act.ID}, nil
+	})
+	response, err := turn.UpdateActivity(ctx, schema.Activity{ID: "1", Text: "Updated"})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, "1", response.ID)
+	assert.Equal(t, []string{"1 abcd1234"}, updated, "Expect hook to receive the addressed activity")
+
+	var deleted []string
+	turn.OnDeleteActivity(
+		func(ctx context.Context, turn *activity.TurnContext, activityID string, next activity.DeleteActivityFunc) error {
+			deleted = append(deleted, "first "+activityID)
+			return next(ctx, activityID)
+		},
+		func(ctx context.Context, turn *activity.TurnContext, activityID string, next activity.DeleteActivityFunc) error {
+			deleted = append(deleted, "second "+activityID)
+			if activityID == "protected" {
+				return nil
+			}
+			return next(ctx, activityID)
+		},
+	)
+	assert.Nil(t, turn.DeleteActivity(ctx, "protected"), "Expect hook to drop the deletion")
+	assert.NotNil(t, turn.DeleteActivity(ctx, "2"), "Expect error deleting without connector client")
+	assert.Equal(t, []string{"first protected", "second protected", "first 2", "second 2"}, deleted)
+	assert.False(t, turn.Responded(), "Expect no activity sent")
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+
+	"github.com/infracloudio/msbotbuilder-go/core/activity"
+	"github.com/infracloudio/msbotbuilder-go/schema"
+	"github.com/infracloudio/msbotbuilder-go/storage"
+	"github.com/pkg/errors"
+)
+
+// StorageKeyFunc returns the storage key of the state of the scope the activity belongs to.
+type StorageKeyFunc func(activity schema.Activity) (string, error)
+
+// BotState persists the properties of a scope of state, like a conversation, as a single storage.Item.
+//
+// The state of the scope of a turn is read when first accessed during the turn and kept in the TurnContext,
+// so that all accessors share it. It is written by SaveChanges.
+type BotState struct {
+	storage    storage.Storage
+	name       string
+	storageKey StorageKeyFunc
+}
+
+// turnStateKey is the key of the state of a BotState in the TurnContext.
+type turnStateKey struct {
+	state *BotState
+}
+
+// cachedState is the state of a scope loaded during a turn.
+type cachedState struct {
+	key        string
+	etag       string
+	properties map[string]interface{}
+	// hash of the properties when last read or written
+	hash []byte
+}
+
+// NewBotState returns a BotState for a custom scope of state, identified by the storage key of the
+// activities. The name describes the scope in errors.
+func NewBotState(s storage.Storage, name string, storageKey StorageKeyFunc) *BotState {
+	return &BotState{storage: s, name: name, storageKey: storageKey}
+}
+
+// NewConversationState returns a BotState for the state of each conversation, stored under the key
+// {channelId}/conversations/{conversationId}.
+func NewConversationState(s storage.Storage) *BotState {
+	return NewBotState(s, "ConversationState", func(activity schema.Activity) (string, error) {
+		if activity.ChannelID == "" || activity.Conversation.ID == "" {
+			return "", errors.New("Invalid activity: missing channelId or conversation.id")
+		}
+		return activity.ChannelID + "/conversations/" + activity.Conversation.ID, nil
+	})
+}
+
+// NewUserState returns a BotState for the state of each user of a channel, across conversations,
+// stored under the key {channelId}/users/{userId}.
+func NewUserState(s storage.Storage) *BotState {
+	return NewBotState(s, "UserState", func(activity schema.Activity) (string, error) {
+		if activity.ChannelID == "" || activity.From.ID == "" {
+			return "", errors.New("Invalid activity: missing channelId or from.id")
+		}
+		return activity.ChannelID + "/users/" + activity.From.ID, nil
+	})
+}
+
+// NewPrivateConversationState returns a BotState for the state of each user in each conversation, stored
+// under the key {channelId}/conversations/{conversationId}/users/{userId}.
+func NewPrivateConversationState(s storage.Storage) *BotState {
+	return NewBotState(s, "PrivateConversationState", func(activity schema.Activity) (string, error) {
+		if activity.ChannelID == "" || activity.Conversation.ID == "" || activity.From.ID == "" {
+			return "", errors.New("Invalid activity: missing channelId, conversation.id or from.id")
+		}
+		return activity.ChannelID + "/conversations/" + activity.Conversation.ID + "/users/" + activity.From.ID, nil
+	})
+}
+
+// Load reads the state of the turn from the storage, unless it was already read during the turn and
+// force is false.
+func (bs *BotState) Load(ctx context.Context, turn *activity.TurnContext, force bool) error {
+	_, err := bs.load(ctx, turn, force)
+	return err
+}
+
+// SaveChanges writes the state of the turn to the storage if it changed since it was read, or
+// unconditionally if force is true. Nothing is written if the state was not accessed during the turn.
+//
+// The state is written with the ETag it was read with, so the error matches storage.ErrETagConflict if
+// another turn changed it in the meantime.
+func (bs *BotState) SaveChanges(ctx context.Context, turn *activity.TurnContext, force bool) error {
+	cached, ok := bs.cached(turn)
+	if !ok {
+		return nil
+	}
+
+	value, hash, err := cached.marshal()
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode %s", bs.name)
+	}
+	if !force && bytes.Equal(hash, cached.hash) {
+		return nil
+	}
+
+	item := &storage.Item{Value: value, ETag: cached.etag}
+	if err := bs.storage.Write(ctx, map[string]*storage.Item{cached.key: item}); err != nil {
+		return errors.Wrapf(err, "Failed to save %s", bs.name)
+	}
+	cached.etag, cached.hash = item.ETag, hash
+	return nil
+}
+
+// Clear removes all the properties of the state of the turn. The state is cleared in the storage by
+// SaveChanges.
+func (bs *BotState) Clear(ctx context.Context, turn *activity.TurnContext) error {
+	cached, err := bs.load(ctx, turn, false)
+	if err != nil {
+		return err
+	}
+	cached.properties = map[string]interface{}{}
+	return nil
+}
+
+// Delete removes the state of the turn from the storage right away.
+func (bs *BotState) Delete(ctx context.Context, turn *activity.TurnContext) error {
+	key, err := bs.storageKey(turn.Activity)
+	if err != nil {
+		return err
+	}
+	if err := bs.storage.Delete(ctx, []string{key}); err != nil {
+		return errors.Wrapf(err, "Failed to delete %s", bs.name)
+	}
+	turn.SetTurnState(turnStateKey{bs}, newCachedState(key, "", map[string]interface{}{}))
+	return nil
+}
+
+func (bs *BotState) cached(turn *activity.TurnContext) (*cachedState, bool) {
+	value, ok := turn.TurnState(turnStateKey{bs})
+	if !ok {
+		return nil, false
+	}
+	return value.(*cachedState), true
+}
+
+// load returns the state of the turn, read from the storage if not done yet during the turn or if forced.
+func (bs *BotState) load(ctx context.Context, turn *activity.TurnContext, force bool) (*cachedState, error) {
+	if cached, ok := bs.cached(turn); ok && !force {
+		return cached, nil
+	}
+
+	key, err := bs.storageKey(turn.Activity)
+	if err != nil {
+		return nil, err
+	}
+	items, err := bs.storage.Read(ctx, []string{key})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to load %s", bs.name)
+	}
+
+	properties := map[string]interface{}{}
+	item, ok := items[key]
+	if ok {
+		stored := map[string]json.RawMessage{}
+		if err := json.Unmarshal(item.Value, &stored); err != nil {
+			return nil, errors.Wrapf(err, "Failed to decode %s", bs.name)
+		}
+		for name, value := range stored {
+			properties[name] = value
+		}
+	}
+	cached := newCachedState(key, item.ETag, properties)
+	turn.SetTurnState(turnStateKey{bs}, cached)
+	return cached, nil
+}
+
+func newCachedState(key, etag string, properties map[string]interface{}) *cachedState {
+	cached := &cachedState{key: key, etag: etag, properties: properties}
+	// Properties read from the storage can always be encoded again
+	_, cached.hash, _ = cached.marshal()
+	return cached
+}
+
+// marshal returns the encoded properties and their hash, telling if they changed.
+func (cs *cachedState) marshal() (json.RawMessage, []byte, error) {
+	value, err := json.Marshal(cs.properties)
+	if err != nil {
+		return nil, nil, err
+	}
+	hash := sha256.Sum256(value)
+	return value, hash[:], nil
+}
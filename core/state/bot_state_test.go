@@ -0,0 +1,255 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/infracloudio/msbotbuilder-go/core/activity"
+	"github.com/infracloudio/msbotbuilder-go/core/state"
+	"github.com/infracloudio/msbotbuilder-go/schema"
+	"github.com/infracloudio/msbotbuilder-go/storage"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStorage counts the reads and writes of a MemoryStorage.
+type countingStorage struct {
+	storage.MemoryStorage
+	reads, writes int
+}
+
+func (s *countingStorage) Read(ctx context.Context, keys []string) (map[string]storage.Item, error) {
+	s.reads++
+	return s.MemoryStorage.Read(ctx, keys)
+}
+
+func (s *countingStorage) Write(ctx context.Context, changes map[string]*storage.Item) error {
+	s.writes++
+	return s.MemoryStorage.Write(ctx, changes)
+}
+
+type profile struct {
+	Name  string   `json:"name"`
+	Tags  []string `json:"tags"`
+	Count int      `json:"count"`
+}
+
+func newTurn(conversationID, userID string) *activity.TurnContext {
+	return activity.NewTurnContext(schema.Activity{
+		Type:         schema.Message,
+		ChannelID:    "msteams",
+		Conversation: schema.ConversationAccount{ID: conversationID},
+		From:         schema.ChannelAccount{ID: userID},
+	}, nil)
+}
+
+func TestStorageKeys(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	for _, test := range []struct {
+		name  string
+		state *state.BotState
+		turn  *activity.TurnContext
+		key   string
+	}{
+		{"Conversation", state.NewConversationState(s), newTurn("conv", "user"), "msteams/conversations/conv"},
+		{"User", state.NewUserState(s), newTurn("conv", "user"), "msteams/users/user"},
+		{"Private conversation", state.NewPrivateConversationState(s), newTurn("conv", "user"), "msteams/conversations/conv/users/user"},
+		{"Missing conversation", state.NewConversationState(s), newTurn("", "user"), ""},
+		{"Missing user", state.NewUserState(s), newTurn("conv", ""), ""},
+		{"Missing channel", state.NewPrivateConversationState(s), activity.NewTurnContext(schema.Activity{}, nil), ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			err := state.NewPropertyAccessor[string](test.state, "property").Set(ctx, test.turn, "value")
+			if test.key == "" {
+				assert.NotNil(t, err, "Expect error for activity without key")
+				return
+			}
+			assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+			assert.Nil(t, test.state.SaveChanges(ctx, test.turn, false))
+
+			items, err := s.Read(ctx, []string{test.key})
+			assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+			assert.JSONEq(t, `{"property":"value"}`, string(items[test.key].Value))
+		})
+	}
+}
+
+func TestPropertyAccessor(t *testing.T) {
+	ctx := context.Background()
+	conversationState := state.NewConversationState(storage.NewMemoryStorage())
+	profileProperty := state.NewPropertyAccessor[profile](conversationState, "profile")
+	countProperty := state.NewPropertyAccessor[int](conversationState, "count")
+
+	turn := newTurn("conv", "user")
+	_, ok, err := profileProperty.Lookup(ctx, turn)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.False(t, ok, "Expect property not to be set")
+
+	assert.Nil(t, profileProperty.Set(ctx, turn, profile{Name: "Ada", Tags: []string{"a"}}))
+	assert.Nil(t, countProperty.Set(ctx, turn, 1))
+	assert.Nil(t, conversationState.SaveChanges(ctx, turn, false))
+
+	// The values are decoded in the next turn
+	turn = newTurn("conv", "other-user")
+	value, ok, err := profileProperty.Lookup(ctx, turn)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.True(t, ok, "Expect property to be set")
+	assert.Equal(t, profile{Name: "Ada", Tags: []string{"a"}}, value)
+	count, err := countProperty.Get(ctx, turn)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, 1, count)
+
+	assert.Nil(t, countProperty.Delete(ctx, turn))
+	assert.Nil(t, conversationState.SaveChanges(ctx, turn, false))
+
+	turn = newTurn("conv", "user")
+	_, ok, err = countProperty.Lookup(ctx, turn)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.False(t, ok, "Expect deleted property not to be set")
+
+	// Another conversation has its own state
+	count, err = countProperty.Get(ctx, newTurn("other-conv", "user"))
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, 0, count)
+
+	// A property of another type fails to decode
+	_, err = state.NewPropertyAccessor[int](conversationState, "profile").Get(ctx, turn)
+	assert.NotNil(t, err, "Expect error decoding property of another type")
+}
+
+func TestLoadOncePerTurn(t *testing.T) {
+	ctx := context.Background()
+	s := &countingStorage{}
+	conversationState := state.NewConversationState(s)
+	countProperty := state.NewPropertyAccessor[int](conversationState, "count")
+	nameProperty := state.NewPropertyAccessor[string](conversationState, "name")
+
+	turn := newTurn("conv", "user")
+	assert.Nil(t, conversationState.SaveChanges(ctx, turn, false))
+	assert.Equal(t, 0, s.reads, "Expect state not to be loaded until accessed")
+
+	for i := 0; i < 3; i++ {
+		_, err := countProperty.Get(ctx, turn)
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		_, err = nameProperty.Get(ctx, turn)
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	}
+	assert.Equal(t, 1, s.reads, "Expect state to be loaded once per turn")
+
+	assert.Nil(t, conversationState.Load(ctx, turn, true))
+	assert.Equal(t, 2, s.reads, "Expect forced load to read the state")
+
+	_, err := countProperty.Get(ctx, newTurn("conv", "user"))
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, 3, s.reads, "Expect state to be loaded in each turn")
+}
+
+func TestSaveChangesOnlyDirty(t *testing.T) {
+	ctx := context.Background()
+	s := &countingStorage{}
+	userState := state.NewUserState(s)
+	profileProperty := state.NewPropertyAccessor[*profile](userState, "profile")
+
+	for _, test := range []struct {
+		name   string
+		change func(turn *activity.TurnContext)
+		force  bool
+		writes int
+	}{
+		{"Not accessed", func(turn *activity.TurnContext) {}, false, 0},
+		{"Read only", func(turn *activity.TurnContext) {
+			_, _ = profileProperty.Get(ctx, turn)
+		}, false, 0},
+		{"Set", func(turn *activity.TurnContext) {
+			_ = profileProperty.Set(ctx, turn, &profile{Name: "Ada"})
+		}, false, 1},
+		{"Set to same value", func(turn *activity.TurnContext) {
+			_ = profileProperty.Set(ctx, turn, &profile{Name: "Ada"})
+		}, false, 0},
+		{"Changed through pointer", func(turn *activity.TurnContext) {
+			value, _ := profileProperty.Get(ctx, turn)
+			value.Count++
+		}, false, 1},
+		{"Forced", func(turn *activity.TurnContext) {
+			_, _ = profileProperty.Get(ctx, turn)
+		}, true, 1},
+		{"Cleared", func(turn *activity.TurnContext) {
+			_ = userState.Clear(ctx, turn)
+		}, false, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s.writes = 0
+			turn := newTurn("conv", "user")
+			test.change(turn)
+			assert.Nil(t, userState.SaveChanges(ctx, turn, test.force))
+			assert.Equal(t, test.writes, s.writes)
+
+			// Saving again writes nothing new
+			assert.Nil(t, userState.SaveChanges(ctx, turn, false))
+			assert.Equal(t, test.writes, s.writes)
+		})
+	}
+}
+
+func TestSaveChangesConflict(t *testing.T) {
+	ctx := context.Background()
+	conversationState := state.NewConversationState(storage.NewMemoryStorage())
+	countProperty := state.NewPropertyAccessor[int](conversationState, "count")
+
+	turn := newTurn("conv", "user")
+	assert.Nil(t, countProperty.Set(ctx, turn, 1))
+	assert.Nil(t, conversationState.SaveChanges(ctx, turn, false))
+
+	// Concurrent turns change the same revision
+	first, second := newTurn("conv", "user"), newTurn("conv", "other-user")
+	assert.Nil(t, countProperty.Set(ctx, first, 2))
+	assert.Nil(t, countProperty.Set(ctx, second, 3))
+	assert.Nil(t, conversationState.SaveChanges(ctx, first, false))
+	err := conversationState.SaveChanges(ctx, second, false)
+	assert.True(t, errors.Is(err, storage.ErrETagConflict), fmt.Sprintf("Unexpected error %v", err))
+
+	// The turn saving its own changes again succeeds
+	assert.Nil(t, countProperty.Set(ctx, first, 4))
+	assert.Nil(t, conversationState.SaveChanges(ctx, first, false))
+}
+
+func TestDeleteState(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemoryStorage()
+	conversationState := state.NewConversationState(s)
+	countProperty := state.NewPropertyAccessor[int](conversationState, "count")
+
+	turn := newTurn("conv", "user")
+	assert.Nil(t, countProperty.Set(ctx, turn, 1))
+	assert.Nil(t, conversationState.SaveChanges(ctx, turn, false))
+
+	assert.Nil(t, conversationState.Delete(ctx, turn))
+	items, err := s.Read(ctx, []string{"msteams/conversations/conv"})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Empty(t, items)
+
+	count, err := countProperty.Get(ctx, turn)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, 0, count, "Expect deleted state to be empty in the turn")
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+/*
+Package state keeps the state of conversations and users across turns in a storage.Storage.
+
+A BotState persists the properties of a scope: ConversationState for each conversation, UserState for
+each user in a channel and PrivateConversationState for each user in a conversation. Properties are
+read and written through a typed StatePropertyAccessor:
+
+	conversationState := state.NewConversationState(storage.NewMemoryStorage())
+	count := state.NewPropertyAccessor[int](conversationState, "count")
+
+	OnMessageFunc: func(turn *activity.TurnContext) (schema.Activity, error) {
+		n, err := count.Get(ctx, turn)
+		...
+		err = count.Set(ctx, turn, n+1)
+		...
+		err = conversationState.SaveChanges(ctx, turn, false)
+	}
+
+The state is read from the storage once per turn, when first accessed, and SaveChanges writes it back
+only if it changed during the turn.
+*/
+package state
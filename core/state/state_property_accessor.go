@@ -0,0 +1,103 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/infracloudio/msbotbuilder-go/core/activity"
+	"github.com/pkg/errors"
+)
+
+// StatePropertyAccessor reads and writes a property of type T of a BotState.
+//
+// Values are encoded as JSON in the storage. Changes made to a value returned by Get, like an element
+// added to a map or a field set through a pointer, are saved as well as the values passed to Set.
+type StatePropertyAccessor[T any] struct {
+	state *BotState
+	name  string
+}
+
+// NewPropertyAccessor returns an accessor of the named property of the state.
+func NewPropertyAccessor[T any](state *BotState, name string) *StatePropertyAccessor[T] {
+	return &StatePropertyAccessor[T]{state: state, name: name}
+}
+
+// Name returns the name of the property.
+func (a *StatePropertyAccessor[T]) Name() string {
+	return a.name
+}
+
+// Get returns the value of the property in the state of the turn, or the zero value of T if it is not set.
+func (a *StatePropertyAccessor[T]) Get(ctx context.Context, turn *activity.TurnContext) (T, error) {
+	value, _, err := a.Lookup(ctx, turn)
+	return value, err
+}
+
+// Lookup returns the value of the property in the state of the turn and if it is set.
+func (a *StatePropertyAccessor[T]) Lookup(ctx context.Context, turn *activity.TurnContext) (T, bool, error) {
+	var value T
+	cached, err := a.state.load(ctx, turn, false)
+	if err != nil {
+		return value, false, err
+	}
+
+	property, ok := cached.properties[a.name]
+	if !ok {
+		return value, false, nil
+	}
+	if value, ok := property.(T); ok {
+		return value, true, nil
+	}
+
+	// Decode the value read from the storage, or set by an accessor of another type
+	encoded, ok := property.(json.RawMessage)
+	if !ok {
+		if encoded, err = json.Marshal(property); err != nil {
+			return value, false, errors.Wrapf(err, "Failed to encode property %q of %s", a.name, a.state.name)
+		}
+	}
+	if err := json.Unmarshal(encoded, &value); err != nil {
+		return value, false, errors.Wrapf(err, "Failed to decode property %q of %s", a.name, a.state.name)
+	}
+	cached.properties[a.name] = value
+	return value, true, nil
+}
+
+// Set sets the value of the property in the state of the turn.
+func (a *StatePropertyAccessor[T]) Set(ctx context.Context, turn *activity.TurnContext, value T) error {
+	cached, err := a.state.load(ctx, turn, false)
+	if err != nil {
+		return err
+	}
+	cached.properties[a.name] = value
+	return nil
+}
+
+// Delete removes the property from the state of the turn.
+func (a *StatePropertyAccessor[T]) Delete(ctx context.Context, turn *activity.TurnContext) error {
+	cached, err := a.state.load(ctx, turn, false)
+	if err != nil {
+		return err
+	}
+	delete(cached.properties, a.name)
+	return nil
+}
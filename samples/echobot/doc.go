@@ -24,18 +24,17 @@ on the respective event.
 		},
 	}
 
-A webserver is started with a hanlder passed the received payload to `adapter.ParseRequest`
-This methods authenticates the payload, parses the request and returns an Activity value.
+A webserver is started with the handler returned by `core.NewHTTPHandler`. It authenticates each
+received payload, parses it into an Activity value and processes the activity as per the hanlder
+functions, sending the response to the connector service.
 
-	activity, err := adapter.ParseRequest(ctx, req)
-
-The Activity is then passed to `adapter.ProcessActivity` with the hanlder created to process
-the activity as per the hanlder functions and send the response to the connector service.
-
-	err = adapter.ProcessActivity(ctx, activity, customHandler)
+	http.Handle("/api/messages", core.NewHTTPHandler(adapter, customHandler))
 
 # In case of no error, this web responds with a 200 status
 
+Authentication failures are answered with a 401 status, malformed payloads with a 400 status
+and failed calls to the connector service with a 502 status.
+
 To expose this local IP outside your local network, a tool like ngrok can be used.
 
 	ngrok http 3978
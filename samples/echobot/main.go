@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -18,30 +17,6 @@ var customHandler = activity.HandlerFuncs{
 	},
 }
 
-// HTTPHandler handles the HTTP requests from then connector service
-type HTTPHandler struct {
-	core.Adapter
-}
-
-func (ht *HTTPHandler) processMessage(w http.ResponseWriter, req *http.Request) {
-
-	ctx := context.Background()
-	activity, err := ht.Adapter.ParseRequest(ctx, req)
-	if err != nil {
-		fmt.Println("Failed to parse request.", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	err = ht.Adapter.ProcessActivity(ctx, activity, customHandler)
-	if err != nil {
-		fmt.Println("Failed to process request", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	fmt.Println("Request processed successfully.")
-}
-
 func main() {
 
 	setting := core.AdapterSetting{
@@ -54,9 +29,11 @@ func main() {
 		log.Fatal("Error creating adapter: ", err)
 	}
 
-	httpHandler := &HTTPHandler{adapter}
-
-	http.HandleFunc("/api/messages", httpHandler.processMessage)
+	// The handler authenticates and parses each request, then processes the activity with customHandler
+	http.Handle("/api/messages", core.NewHTTPHandler(adapter, customHandler, core.HTTPOptionErrorHandler(
+		func(req *http.Request, err error) {
+			fmt.Println("Failed to process request.", err)
+		})))
 	fmt.Println("Starting server on port:3978...")
 	http.ListenAndServe(":3978", nil)
 }
@@ -134,7 +134,8 @@ func (ht *HTTPHandler) processMessage(w http.ResponseWriter, req *http.Request)
 		},
 	}
 
-	err = ht.Adapter.ProcessActivity(ctx, act, customHandler)
+	// ServeActivity also answers the invoke activity with the HTTP response Teams waits for
+	err = ht.Adapter.(core.ActivityServer).ServeActivity(ctx, w, act, customHandler)
 	if err != nil {
 		fmt.Println("Failed to process request.", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -19,14 +19,140 @@
 
 package customerror
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/schema"
+)
+
+var (
+	// ErrThrottled is matched by an HTTPError with status 429 Too Many Requests.
+	ErrThrottled = errors.New("throttled")
+	// ErrUnauthorized is matched by an HTTPError with status 401 Unauthorized.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is matched by an HTTPError with status 403 Forbidden.
+	ErrForbidden = errors.New("forbidden")
+	// ErrNotFound is matched by an HTTPError with status 404 Not Found.
+	ErrNotFound = errors.New("not found")
+)
 
 // HTTPError wraps a raw HTTP error
 type HTTPError struct {
 	StatusCode int
 	HtErr      error
+
+	// Method and URL of the failed request, if known.
+	Method string
+	URL    string
+
+	// ErrorResponse is the error reported by the connector service in the response body, if any.
+	ErrorResponse *schema.ErrorResponse
+
+	// RetryAfter is the delay requested by the Retry-After response header, or zero.
+	RetryAfter time.Duration
+
+	// CorrelationVector is the MS-CV response header, and CorrelationID the request or correlation ID
+	// response header, identifying the request when reporting issues to the channel.
+	CorrelationVector string
+	CorrelationID     string
+}
+
+// correlationHeaders lists the headers used for CorrelationID, in order of preference.
+var correlationHeaders = []string{"x-ms-correlation-id", "x-ms-request-id", "request-id"}
+
+// NewHTTPErrorFromResponse returns an HTTPError describing the failed response. The ErrorResponse,
+// if any, should already be decoded from the response body as the body is not read here.
+func NewHTTPErrorFromResponse(resp *http.Response, errResp *schema.ErrorResponse) HTTPError {
+	htErr := HTTPError{
+		StatusCode:        resp.StatusCode,
+		ErrorResponse:     errResp,
+		RetryAfter:        ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		CorrelationVector: resp.Header.Get("MS-CV"),
+	}
+	for _, header := range correlationHeaders {
+		if id := resp.Header.Get(header); id != "" {
+			htErr.CorrelationID = id
+			break
+		}
+	}
+	if resp.Request != nil {
+		htErr.Method = resp.Request.Method
+		htErr.URL = resp.Request.URL.String()
+	}
+
+	if errResp != nil && (errResp.Error.Code != "" || errResp.Error.Message != "") {
+		htErr.HtErr = fmt.Errorf("%s: %s", errResp.Error.Code, errResp.Error.Message)
+	} else {
+		htErr.HtErr = errors.New("invalid response")
+	}
+	return htErr
+}
+
+// ParseRetryAfter parses the value of a Retry-After header, given either in seconds or as a HTTP date.
+// Returns zero if the value is empty or invalid.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
 }
 
 func (htErr HTTPError) Error() string {
+	if htErr.Method != "" {
+		return fmt.Sprintf("HTTP error %d (%s %s): %s.", htErr.StatusCode, htErr.Method, htErr.URL, htErr.HtErr)
+	}
 	return fmt.Sprintf("HTTP error %d: %s.", htErr.StatusCode, htErr.HtErr)
 }
+
+// Unwrap returns the underlying error.
+func (htErr HTTPError) Unwrap() error {
+	return htErr.HtErr
+}
+
+// Is reports whether the status code of the error corresponds to the target sentinel error.
+func (htErr HTTPError) Is(target error) bool {
+	switch target {
+	case ErrThrottled:
+		return htErr.StatusCode == http.StatusTooManyRequests
+	case ErrUnauthorized:
+		return htErr.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return htErr.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return htErr.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// IsThrottled returns if err is, or wraps, an HTTPError with status 429 Too Many Requests.
+func IsThrottled(err error) bool {
+	return errors.Is(err, ErrThrottled)
+}
+
+// IsUnauthorized returns if err is, or wraps, an HTTPError with status 401 Unauthorized.
+func IsUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
+
+// IsForbidden returns if err is, or wraps, an HTTPError with status 403 Forbidden.
+func IsForbidden(err error) bool {
+	return errors.Is(err, ErrForbidden)
+}
+
+// IsNotFound returns if err is, or wraps, an HTTPError with status 404 Not Found.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
@@ -0,0 +1,359 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package boltstorage implements storage.Storage in an embedded bbolt database, for bots running as a single
+// instance with a persistent volume.
+package boltstorage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/storage"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultBucket is the bucket of the items unless set with WithBucket.
+const DefaultBucket = "state"
+
+// Timeout to obtain the lock of the database file, held by a single process at a time
+const openTimeout = 5 * time.Second
+
+// compactTxMaxSize bounds the size of the transactions copying the items during Compact.
+const compactTxMaxSize = 64 << 20
+
+// Storage is a storage.Storage keeping the items in a bucket of a bbolt database file.
+//
+// Items not written for the TTL set with WithTTL expire: they are no longer read and are removed by
+// DeleteExpired or Compact.
+type Storage struct {
+	path   string
+	bucket []byte
+	ttl    time.Duration
+	now    func() time.Time
+	// shared is set if the database was opened by the caller of New
+	shared bool
+
+	// mu guards db, which is replaced by Compact
+	mu sync.RWMutex
+	db *bolt.DB
+}
+
+// Option configures a Storage.
+type Option func(*Storage)
+
+// WithTTL expires the items not written for the duration. Zero keeps items forever.
+func WithTTL(ttl time.Duration) Option {
+	return func(s *Storage) {
+		s.ttl = ttl
+	}
+}
+
+// WithClock sets the clock deciding when items expire, time.Now by default.
+func WithClock(now func() time.Time) Option {
+	return func(s *Storage) {
+		s.now = now
+	}
+}
+
+// WithBucket keeps the items in the named bucket. Storages created with New for the same database need
+// different buckets; bbolt locks the database file, so it cannot be shared by storages created with Open.
+func WithBucket(name string) Option {
+	return func(s *Storage) {
+		s.bucket = []byte(name)
+	}
+}
+
+// record is the value of an item in the bucket.
+type record struct {
+	ETag  string          `json:"eTag"`
+	Value json.RawMessage `json:"value"`
+	// Expires is the expiry time in Unix nanoseconds, zero if the item does not expire
+	Expires int64 `json:"expires,omitempty"`
+}
+
+// Open opens the database file at path, creating it if it does not exist. The file is locked until
+// the Storage is closed.
+func Open(path string, options ...Option) (*Storage, error) {
+	s := &Storage{path: path, bucket: []byte(DefaultBucket), now: time.Now}
+	for _, option := range options {
+		option(s)
+	}
+
+	db, err := s.open(path)
+	if err != nil {
+		return nil, err
+	}
+	s.db = db
+	return s, nil
+}
+
+// New returns a Storage keeping the items in a bucket of a database opened by the caller, which may
+// share it with other storages using other buckets. The database is not closed by Close, and cannot
+// be compacted with Compact.
+func New(db *bolt.DB, options ...Option) (*Storage, error) {
+	if db == nil {
+		return nil, errors.New("Invalid nil database")
+	}
+	s := &Storage{path: db.Path(), bucket: []byte(DefaultBucket), now: time.Now, shared: true}
+	for _, option := range options {
+		option(s)
+	}
+
+	if err := s.createBucket(db); err != nil {
+		return nil, err
+	}
+	s.db = db
+	return s, nil
+}
+
+func (s *Storage) open(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open %s", path)
+	}
+	if err := s.createBucket(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (s *Storage) createBucket(db *bolt.DB) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(s.bucket)
+		return err
+	})
+	return errors.Wrapf(err, "Failed to create bucket %q", s.bucket)
+}
+
+// Close closes the database file, unless the Storage was created with New.
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shared {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Read returns the stored items of the keys which have not expired.
+func (s *Storage) Read(ctx context.Context, keys []string) (map[string]storage.Item, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make(map[string]storage.Item, len(keys))
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(s.bucket)
+		for _, key := range keys {
+			stored, ok, err := s.get(bucket, key)
+			if err != nil {
+				return err
+			}
+			if ok {
+				items[key] = storage.Item{Value: stored.Value, ETag: stored.ETag}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Write stores the changed items in a single transaction, so none of them are written if an ETag
+// does not match. Writing an item resets its expiry.
+func (s *Storage) Write(ctx context.Context, changes map[string]*storage.Item) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	etags := make(map[string]string, len(changes))
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(s.bucket)
+		for key, change := range changes {
+			if change == nil {
+				return errors.Errorf("Invalid nil item for key %q", key)
+			}
+			stored, ok, err := s.get(bucket, key)
+			if err != nil {
+				return err
+			}
+			if ok && change.ETag != "" && change.ETag != storage.AnyETag && change.ETag != stored.ETag {
+				return errors.Wrapf(storage.ErrETagConflict, "Failed to write key %q", key)
+			}
+
+			value := change.Value
+			if value == nil {
+				value = json.RawMessage("null")
+			}
+			updated := record{ETag: storage.NewETag(), Value: value}
+			if s.ttl > 0 {
+				updated.Expires = s.now().Add(s.ttl).UnixNano()
+			}
+			data, err := json.Marshal(updated)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to encode key %q", key)
+			}
+			if err := bucket.Put([]byte(key), data); err != nil {
+				return errors.Wrapf(err, "Failed to write key %q", key)
+			}
+			etags[key] = updated.ETag
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, etag := range etags {
+		changes[key].ETag = etag
+	}
+	return nil
+}
+
+// Delete removes the stored items of the keys.
+func (s *Storage) Delete(ctx context.Context, keys []string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(s.bucket)
+		for _, key := range keys {
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return errors.Wrapf(err, "Failed to delete key %q", key)
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteExpired removes the expired items and returns how many were removed.
+func (s *Storage) DeleteExpired(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.deleteExpired(ctx)
+}
+
+func (s *Storage) deleteExpired(ctx context.Context) (int, error) {
+	if s.ttl <= 0 {
+		return 0, nil
+	}
+
+	deleted := 0
+	now := s.now().UnixNano()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(s.bucket).Cursor()
+		for key, data := cursor.First(); key != nil; {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			stored := record{}
+			if err := json.Unmarshal(data, &stored); err != nil {
+				return errors.Wrapf(err, "Failed to decode key %q", key)
+			}
+			if stored.Expires == 0 || stored.Expires > now {
+				key, data = cursor.Next()
+				continue
+			}
+			// Deleting moves the cursor to the next item
+			if err := cursor.Delete(); err != nil {
+				return errors.Wrapf(err, "Failed to delete key %q", key)
+			}
+			deleted++
+			key, data = cursor.Seek(key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// Compact removes the expired items and rewrites the database file to release the space of removed
+// items, which bbolt otherwise keeps for reuse. Other calls wait until it completes.
+//
+// If Compact fails, the Storage keeps using the database as it was. This is the case on platforms where
+// a file cannot be replaced while open, like Windows. Storages created with New cannot be compacted, as
+// the database is shared.
+func (s *Storage) Compact(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shared {
+		return errors.New("Cannot compact a database opened by the caller of New")
+	}
+
+	if _, err := s.deleteExpired(ctx); err != nil {
+		return err
+	}
+
+	tmpPath := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".compact")
+	os.Remove(tmpPath)
+	compacted, err := bolt.Open(tmpPath, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return errors.Wrap(err, "Failed to create compacted database")
+	}
+	err = bolt.Compact(compacted, s.db, compactTxMaxSize)
+	if closeErr := compacted.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrap(err, "Failed to compact database")
+	}
+
+	// The compacted database is open before it replaces the file, so the Storage keeps a usable
+	// database whatever fails
+	db, err := s.open(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrap(err, "Failed to compact database")
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		db.Close()
+		os.Remove(tmpPath)
+		return errors.Wrap(err, "Failed to replace database with compacted one")
+	}
+	replaced := s.db
+	s.db = db
+	return errors.Wrap(replaced.Close(), "Failed to close database replaced by compacted one")
+}
+
+// get returns the record of the key in the bucket, unless it has expired.
+func (s *Storage) get(bucket *bolt.Bucket, key string) (record, bool, error) {
+	data := bucket.Get([]byte(key))
+	if data == nil {
+		return record{}, false, nil
+	}
+	stored := record{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return record{}, false, errors.Wrapf(err, "Failed to decode key %q", key)
+	}
+	if stored.Expires != 0 && stored.Expires <= s.now().UnixNano() {
+		return record{}, false, nil
+	}
+	return stored, true, nil
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package boltstorage_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/storage"
+	"github.com/infracloudio/msbotbuilder-go/storage/boltstorage"
+	"github.com/infracloudio/msbotbuilder-go/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func open(t *testing.T, path string, options ...boltstorage.Option) *boltstorage.Storage {
+	s, err := boltstorage.Open(path, options...)
+	if err != nil {
+		t.Fatalf("Failed to open storage: %s", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return open(t, filepath.Join(t.TempDir(), "state.db"))
+	})
+}
+
+func TestStoragePersisted(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+	s := open(t, path)
+	item := &storage.Item{Value: json.RawMessage(`{"count":1}`)}
+	assert.Nil(t, s.Write(ctx, map[string]*storage.Item{"key": item}))
+	assert.Nil(t, s.Close())
+
+	// Buckets keep the items of storages sharing the file apart
+	other := open(t, path, boltstorage.WithBucket("other"))
+	items, err := other.Read(ctx, []string{"key"})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Empty(t, items)
+	assert.Nil(t, other.Close())
+
+	reopened := open(t, path)
+	items, err = reopened.Read(ctx, []string{"key"})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.JSONEq(t, `{"count":1}`, string(items["key"].Value))
+	assert.Equal(t, item.ETag, items["key"].ETag)
+}
+
+func TestStorageSharedDatabase(t *testing.T) {
+	ctx := context.Background()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "state.db"), 0600, nil)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	defer db.Close()
+
+	conversations, err := boltstorage.New(db, boltstorage.WithBucket("conversations"))
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	users, err := boltstorage.New(db, boltstorage.WithBucket("users"))
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	assert.Nil(t, conversations.Write(ctx, map[string]*storage.Item{"key": {Value: json.RawMessage(`1`)}}))
+	assert.Nil(t, users.Write(ctx, map[string]*storage.Item{"key": {Value: json.RawMessage(`2`)}}))
+	items, err := conversations.Read(ctx, []string{"key"})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.JSONEq(t, `1`, string(items["key"].Value), "Expect buckets to keep the items apart")
+
+	assert.NotNil(t, users.Compact(ctx), "Expect shared database not to be compacted")
+	assert.Nil(t, users.Close())
+	items, err = conversations.Read(ctx, []string{"key"})
+	assert.Nil(t, err, "Expect database to stay open for the other storages")
+	assert.Len(t, items, 1)
+}
+
+func TestStorageTTL(t *testing.T) {
+	ctx := context.Background()
+	const ttl = time.Hour
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	s := open(t, filepath.Join(t.TempDir(), "state.db"), boltstorage.WithTTL(ttl), boltstorage.WithClock(clock))
+
+	assert.Nil(t, s.Write(ctx, map[string]*storage.Item{
+		"stale":  {Value: json.RawMessage(`1`)},
+		"active": {Value: json.RawMessage(`1`)},
+	}))
+	now = now.Add(ttl / 2)
+	// Writing resets the expiry
+	assert.Nil(t, s.Write(ctx, map[string]*storage.Item{"active": {Value: json.RawMessage(`2`)}}))
+	now = now.Add(ttl/2 + ttl/4)
+
+	items, err := s.Read(ctx, []string{"stale", "active"})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.NotContains(t, items, "stale", "Expect expired item not to be read")
+	assert.Contains(t, items, "active")
+
+	// An expired item is missing, so its ETag is not checked
+	err = s.Write(ctx, map[string]*storage.Item{"stale": {Value: json.RawMessage(`3`), ETag: "expired"}})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	now = now.Add(ttl)
+	deleted, err := s.DeleteExpired(ctx)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, 2, deleted)
+	deleted, err = s.DeleteExpired(ctx)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Equal(t, 0, deleted)
+}
+
+func TestStorageCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+	s := open(t, path)
+
+	value := json.RawMessage(`"` + strings.Repeat("x", 4096) + `"`)
+	keys := make([]string, 0, 1000)
+	for i := 0; i < cap(keys); i++ {
+		key := fmt.Sprintf("msteams/conversations/%d", i)
+		keys = append(keys, key)
+		assert.Nil(t, s.Write(ctx, map[string]*storage.Item{key: {Value: value}}))
+	}
+	assert.Nil(t, s.Delete(ctx, keys[1:]))
+	before, err := os.Stat(path)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	assert.Nil(t, s.Compact(ctx))
+	after, err := os.Stat(path)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Less(t, after.Size(), before.Size()/10, "Expect compaction to release the space of deleted items")
+
+	items, err := s.Read(ctx, keys[:1])
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.JSONEq(t, string(value), string(items[keys[0]].Value))
+	assert.Nil(t, s.Write(ctx, map[string]*storage.Item{"key": {Value: value}}), "Expect storage usable after compaction")
+
+	assert.Nil(t, s.Close())
+	items, err = open(t, path).Read(ctx, []string{"key"})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Contains(t, items, "key", "Expect items written after compaction to be persisted")
+}
+
+func TestStorageCompactFailure(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := open(t, filepath.Join(dir, "state.db"))
+	assert.Nil(t, s.Write(ctx, map[string]*storage.Item{"key": {Value: json.RawMessage(`1`)}}))
+
+	// A directory in place of the compacted database cannot be opened
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, ".state.db.compact", "busy"), 0700))
+	assert.NotNil(t, s.Compact(ctx), "Expect compaction to fail")
+
+	items, err := s.Read(ctx, []string{"key"})
+	assert.Nil(t, err, "Expect storage usable after a failed compaction")
+	assert.JSONEq(t, `1`, string(items["key"].Value))
+	assert.Nil(t, s.Write(ctx, map[string]*storage.Item{"key": {Value: json.RawMessage(`2`)}}), "Expect storage usable after a failed compaction")
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+/*
+Package storage persists the state of bots, like the state of conversations and users, as JSON documents.
+
+Storage is implemented by MemoryStorage, for tests and single instance bots, and FileStorage, which keeps
+each document in a file of a directory. The boltstorage package keeps them in an embedded database, with
+expiry of stale items, and the redisstorage package on a Redis server shared by the replicas of a bot. The
+storagetest package tests that other implementations behave like these.
+
+Each stored Item carries an ETag identifying its revision, used for optimistic concurrency: a write with
+the ETag of an older revision fails with ErrETagConflict instead of overwriting changes it has not seen.
+*/
+package storage
@@ -0,0 +1,170 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FileStorage is a Storage keeping each item in a JSON file of the directory Dir, named after the SHA-256
+// hash of the key so that any key, like a Teams conversation ID, gives a valid file name of bounded length
+// on every platform. Files are replaced atomically, so readers never see partially written items.
+//
+// The ETags are checked by the FileStorage, so the directory must not be shared with other processes.
+type FileStorage struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// fileItem is the content of the file of an item.
+type fileItem struct {
+	ETag  string          `json:"eTag"`
+	Value json.RawMessage `json:"value"`
+}
+
+// NewFileStorage returns a FileStorage in the directory, which is created if it does not exist.
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "Failed to create storage directory")
+	}
+	return &FileStorage{Dir: dir}, nil
+}
+
+// Read returns the stored items of the keys.
+func (s *FileStorage) Read(ctx context.Context, keys []string) (map[string]Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make(map[string]Item, len(keys))
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		item, ok, err := s.read(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			items[key] = item
+		}
+	}
+	return items, nil
+}
+
+// Write stores the changed items, none of them if an ETag does not match.
+//
+// An error writing a file may leave the items written before it stored.
+func (s *FileStorage) Write(ctx context.Context, changes map[string]*Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := checkETags(changes, s.read); err != nil {
+		return err
+	}
+
+	for key, change := range changes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		etag := NewETag()
+		if err := s.write(key, fileItem{ETag: etag, Value: change.Value}); err != nil {
+			return err
+		}
+		change.ETag = etag
+	}
+	return nil
+}
+
+// Delete removes the files of the keys.
+func (s *FileStorage) Delete(ctx context.Context, keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		err := os.Remove(s.path(key))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "Failed to delete key %q", key)
+		}
+	}
+	return nil
+}
+
+func (s *FileStorage) path(key string) string {
+	// Lowercase hex digits are valid in file names on case-insensitive file systems too
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(hash[:])+".json")
+}
+
+func (s *FileStorage) read(key string) (Item, bool, error) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return Item{}, false, nil
+	}
+	if err != nil {
+		return Item{}, false, errors.Wrapf(err, "Failed to read key %q", key)
+	}
+
+	stored := fileItem{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return Item{}, false, errors.Wrapf(err, "Failed to decode key %q", key)
+	}
+	return Item{Value: stored.Value, ETag: stored.ETag}, true, nil
+}
+
+// write replaces the file of the key by renaming a temporary file written with the item.
+func (s *FileStorage) write(key string, item fileItem) error {
+	if item.Value == nil {
+		item.Value = json.RawMessage("null")
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to encode key %q", key)
+	}
+
+	file, err := ioutil.TempFile(s.Dir, ".tmp-*")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write key %q", key)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), s.path(key))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return errors.Wrapf(err, "Failed to write key %q", key)
+	}
+	return nil
+}
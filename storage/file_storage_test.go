@@ -0,0 +1,92 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package storage_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/infracloudio/msbotbuilder-go/storage"
+	"github.com/infracloudio/msbotbuilder-go/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewFileStorage(filepath.Join(t.TempDir(), "state"))
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		return s
+	})
+}
+
+func TestFileStoragePersisted(t *testing.T) {
+	dir := t.TempDir()
+	s, err := storage.NewFileStorage(dir)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	item := &storage.Item{Value: json.RawMessage(`{"count":1}`)}
+	err = s.Write(context.Background(), map[string]*storage.Item{"../conversation": item})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+
+	// Files stay in the directory whatever the key
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Len(t, files, 1)
+
+	reopened, err := storage.NewFileStorage(dir)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	items, err := reopened.Read(context.Background(), []string{"../conversation"})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.JSONEq(t, `{"count":1}`, string(items["../conversation"].Value))
+	assert.Equal(t, item.ETag, items["../conversation"].ETag)
+}
+
+func TestFileStorageFileNames(t *testing.T) {
+	dir := t.TempDir()
+	s, err := storage.NewFileStorage(dir)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	keys := []string{
+		"msteams/conversations/19:abcd1234@thread.v2/users/29:AbC",
+		"msteams/conversations/19:abcd1234@thread.v2/users/29:abc",
+		"msteams/conversations/a:1" + strings.Repeat("x", 300) + ";messageid=1",
+	}
+	changes := map[string]*storage.Item{}
+	for i, key := range keys {
+		changes[key] = &storage.Item{Value: json.RawMessage(fmt.Sprintf(`{"count":%d}`, i))}
+	}
+	assert.Nil(t, s.Write(context.Background(), changes), "Expect no error")
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Len(t, files, len(keys), "Expect a file per key, even for keys differing only in case")
+	for _, file := range files {
+		assert.Regexp(t, "^[0-9a-f]{64}\\.json$", file.Name(), "Expect portable file names of bounded length")
+	}
+
+	items, err := s.Read(context.Background(), keys)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	for i, key := range keys {
+		assert.JSONEq(t, fmt.Sprintf(`{"count":%d}`, i), string(items[key].Value))
+	}
+}
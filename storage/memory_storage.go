@@ -0,0 +1,86 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStorage is a Storage keeping the items in memory, so they are lost when the bot restarts.
+//
+// The zero value is an empty storage ready to use.
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	items map[string]Item
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+// Read returns the stored items of the keys.
+func (s *MemoryStorage) Read(ctx context.Context, keys []string) (map[string]Item, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make(map[string]Item, len(keys))
+	for _, key := range keys {
+		if item, ok := s.items[key]; ok {
+			items[key] = Item{Value: cloneValue(item.Value), ETag: item.ETag}
+		}
+	}
+	return items, nil
+}
+
+// Write stores the changed items, all of them or none if an ETag does not match.
+func (s *MemoryStorage) Write(ctx context.Context, changes map[string]*Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := checkETags(changes, func(key string) (Item, bool, error) {
+		item, ok := s.items[key]
+		return item, ok, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.items == nil {
+		s.items = make(map[string]Item, len(changes))
+	}
+	for key, change := range changes {
+		change.ETag = NewETag()
+		s.items[key] = Item{Value: cloneValue(change.Value), ETag: change.ETag}
+	}
+	return nil
+}
+
+// Delete removes the stored items of the keys.
+func (s *MemoryStorage) Delete(ctx context.Context, keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.items, key)
+	}
+	return nil
+}
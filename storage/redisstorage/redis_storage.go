@@ -0,0 +1,179 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package redisstorage implements storage.Storage on a server speaking the Redis protocol, so that the
+// replicas of a bot share their state.
+package redisstorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/infracloudio/msbotbuilder-go/storage"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// writeScript writes the items of KEYS, with the TTL in milliseconds ARGV[1] and for each key the expected
+// ETag, the new ETag and the value in ARGV, if the expected ETags match. Returns the index of the first
+// key with a conflicting ETag, or 0.
+var writeScript = redis.NewScript(`
+local ttl = tonumber(ARGV[1])
+for i, key in ipairs(KEYS) do
+	local expected = ARGV[i * 3 - 1]
+	if expected ~= "" and expected ~= "*" then
+		local current = redis.call("HGET", key, "eTag")
+		if current and current ~= expected then
+			return i
+		end
+	end
+end
+for i, key in ipairs(KEYS) do
+	redis.call("HSET", key, "eTag", ARGV[i * 3], "value", ARGV[i * 3 + 1])
+	if ttl > 0 then
+		redis.call("PEXPIRE", key, ttl)
+	else
+		redis.call("PERSIST", key)
+	end
+end
+return 0
+`)
+
+// Storage is a storage.Storage keeping each item in a Redis hash with the fields eTag and value.
+//
+// ETags are checked and items written by a Lua script, so the changes of a Write are applied atomically.
+// With Redis Cluster, the keys written together must belong to the same hash slot, which a key prefix
+// with a hash tag like "{bot}:" ensures.
+type Storage struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+// Option configures a Storage.
+type Option func(*Storage)
+
+// WithTTL expires the items not written for the duration. Zero keeps items forever.
+func WithTTL(ttl time.Duration) Option {
+	return func(s *Storage) {
+		s.ttl = ttl
+	}
+}
+
+// WithKeyPrefix prepends the prefix to the keys of the items in Redis, so that bots can share a server.
+func WithKeyPrefix(prefix string) Option {
+	return func(s *Storage) {
+		s.prefix = prefix
+	}
+}
+
+// New returns a Storage using the client, like a *redis.Client or a *redis.ClusterClient. The client
+// is not closed by the Storage.
+func New(client redis.UniversalClient, options ...Option) *Storage {
+	s := &Storage{client: client}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// Read returns the stored items of the keys.
+func (s *Storage) Read(ctx context.Context, keys []string) (map[string]storage.Item, error) {
+	items := make(map[string]storage.Item, len(keys))
+	if len(keys) == 0 {
+		return items, nil
+	}
+
+	// Keys of different hash slots cannot be read by a single command
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HMGet(ctx, s.prefix+key, "eTag", "value")
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, errors.Wrap(err, "Failed to read items")
+	}
+
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		etag, ok := fields[0].(string)
+		if !ok {
+			continue
+		}
+		value, _ := fields[1].(string)
+		items[keys[i]] = storage.Item{Value: []byte(value), ETag: etag}
+	}
+	return items, nil
+}
+
+// Write stores the changed items, none of them if an ETag does not match. Writing an item resets its expiry.
+func (s *Storage) Write(ctx context.Context, changes map[string]*storage.Item) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(changes))
+	redisKeys := make([]string, 0, len(changes))
+	etags := make([]string, 0, len(changes))
+	args := make([]interface{}, 1, 1+3*len(changes))
+	args[0] = s.ttl.Milliseconds()
+	for key, change := range changes {
+		if change == nil {
+			return errors.Errorf("Invalid nil item for key %q", key)
+		}
+		value := string(change.Value)
+		if change.Value == nil {
+			value = "null"
+		}
+		etag := storage.NewETag()
+		keys = append(keys, key)
+		redisKeys = append(redisKeys, s.prefix+key)
+		etags = append(etags, etag)
+		args = append(args, change.ETag, etag, value)
+	}
+
+	conflict, err := writeScript.Run(ctx, s.client, redisKeys, args...).Int()
+	if err != nil {
+		return errors.Wrap(err, "Failed to write items")
+	}
+	if conflict > 0 {
+		return errors.Wrapf(storage.ErrETagConflict, "Failed to write key %q", keys[conflict-1])
+	}
+
+	for i, key := range keys {
+		changes[key].ETag = etags[i]
+	}
+	return nil
+}
+
+// Delete removes the stored items of the keys.
+func (s *Storage) Delete(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	pipe := s.client.Pipeline()
+	for _, key := range keys {
+		pipe.Del(ctx, s.prefix+key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return errors.Wrap(err, "Failed to delete items")
+	}
+	return nil
+}
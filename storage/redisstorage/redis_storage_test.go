@@ -0,0 +1,105 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redisstorage_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/infracloudio/msbotbuilder-go/core/activity"
+	"github.com/infracloudio/msbotbuilder-go/core/state"
+	"github.com/infracloudio/msbotbuilder-go/schema"
+	"github.com/infracloudio/msbotbuilder-go/storage"
+	"github.com/infracloudio/msbotbuilder-go/storage/redisstorage"
+	"github.com/infracloudio/msbotbuilder-go/storage/storagetest"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// newClient returns a client of an in-process Redis server.
+func newClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		_, client := newClient(t)
+		return redisstorage.New(client)
+	})
+}
+
+func TestStorageTTL(t *testing.T) {
+	ctx := context.Background()
+	server, client := newClient(t)
+	s := redisstorage.New(client, redisstorage.WithTTL(time.Hour), redisstorage.WithKeyPrefix("bot:"))
+
+	assert.Nil(t, s.Write(ctx, map[string]*storage.Item{
+		"stale":  {Value: json.RawMessage(`1`)},
+		"active": {Value: json.RawMessage(`1`)},
+	}))
+	assert.True(t, server.Exists("bot:stale"), "Expect keys to be prefixed")
+	assert.Equal(t, time.Hour, server.TTL("bot:stale"))
+
+	server.FastForward(30 * time.Minute)
+	// Writing resets the expiry
+	assert.Nil(t, s.Write(ctx, map[string]*storage.Item{"active": {Value: json.RawMessage(`2`)}}))
+	server.FastForward(45 * time.Minute)
+
+	items, err := s.Read(ctx, []string{"stale", "active"})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.NotContains(t, items, "stale", "Expect expired item not to be read")
+	assert.JSONEq(t, `2`, string(items["active"].Value))
+
+	// Without TTL items are kept forever
+	assert.Nil(t, redisstorage.New(client, redisstorage.WithKeyPrefix("bot:")).Write(ctx, map[string]*storage.Item{"active": {Value: json.RawMessage(`3`)}}))
+	assert.Equal(t, time.Duration(0), server.TTL("bot:active"))
+}
+
+func TestConversationState(t *testing.T) {
+	ctx := context.Background()
+	_, client := newClient(t)
+	// Replicas of the bot share the state through the server
+	replicas := []*state.BotState{
+		state.NewConversationState(redisstorage.New(client)),
+		state.NewConversationState(redisstorage.New(client)),
+	}
+
+	for i := 0; i < 4; i++ {
+		conversationState := replicas[i%len(replicas)]
+		count := state.NewPropertyAccessor[int](conversationState, "count")
+		turn := activity.NewTurnContext(schema.Activity{
+			ChannelID:    "msteams",
+			Conversation: schema.ConversationAccount{ID: "conv"},
+		}, nil)
+
+		n, err := count.Get(ctx, turn)
+		assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+		assert.Equal(t, i, n)
+		assert.Nil(t, count.Set(ctx, turn, n+1))
+		assert.Nil(t, conversationState.SaveChanges(ctx, turn, false))
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// ErrETagConflict is matched, using errors.Is, by the errors returned by Write when the ETag of an item
+// does not match the ETag of the stored item.
+var ErrETagConflict = errors.New("ETag conflict")
+
+// AnyETag as the ETag of an Item written overwrites the stored item whatever its revision.
+const AnyETag = "*"
+
+// Item is a JSON document persisted in Storage.
+//
+// ETag identifies the revision of the stored document. It is set by Read and Write, and is passed back
+// to Write to update the document only if it was not changed in the meantime.
+type Item struct {
+	Value json.RawMessage
+	ETag  string
+}
+
+// Storage persists items by key.
+type Storage interface {
+	// Read returns the stored items of the keys. Keys without a stored item are missing from the result.
+	Read(ctx context.Context, keys []string) (map[string]Item, error)
+	// Write stores the changed items by key and sets their ETag to the one of the new revision.
+	//
+	// An item with an empty ETag or AnyETag is written unconditionally. Otherwise its ETag must be
+	// the one of the stored item, if any, or none of the changes are written and the error matches
+	// ErrETagConflict.
+	Write(ctx context.Context, changes map[string]*Item) error
+	// Delete removes the stored items of the keys, ignoring keys without a stored item.
+	Delete(ctx context.Context, keys []string) error
+}
+
+// checkETags returns an error matching ErrETagConflict if a change is based on an older revision than
+// the stored item, returned by stored.
+func checkETags(changes map[string]*Item, stored func(key string) (Item, bool, error)) error {
+	for key, change := range changes {
+		if change == nil {
+			return errors.Errorf("Invalid nil item for key %q", key)
+		}
+		if change.ETag == "" || change.ETag == AnyETag {
+			continue
+		}
+		item, ok, err := stored(key)
+		if err != nil {
+			return err
+		}
+		if ok && item.ETag != change.ETag {
+			return errors.Wrapf(ErrETagConflict, "Failed to write key %q", key)
+		}
+	}
+	return nil
+}
+
+// NewETag returns a random ETag for a new revision of an item, for implementations of Storage.
+func NewETag() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// cloneValue returns a copy of the value, so that stored values are not shared with callers. A nil
+// value is stored as JSON null.
+func cloneValue(value json.RawMessage) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+	return append(json.RawMessage(nil), value...)
+}
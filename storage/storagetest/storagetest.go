@@ -0,0 +1,208 @@
+// Copyright (c) 2020 InfraCloud Technologies
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package storagetest tests that implementations of storage.Storage behave like the ones of the storage package.
+package storagetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/infracloudio/msbotbuilder-go/storage"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// Run runs the conformance tests of storage.Storage as subtests of t, each with an empty storage
+// returned by newStorage.
+func Run(t *testing.T, newStorage func(t *testing.T) storage.Storage) {
+	for _, test := range []struct {
+		name string
+		test func(t *testing.T, s storage.Storage)
+	}{
+		{"ReadMissing", testReadMissing},
+		{"WriteRead", testWriteRead},
+		{"WriteSetsETag", testWriteSetsETag},
+		{"ETagConflict", testETagConflict},
+		{"ConflictWritesNothing", testConflictWritesNothing},
+		{"UnconditionalWrite", testUnconditionalWrite},
+		{"Delete", testDelete},
+		{"ValuesNotShared", testValuesNotShared},
+		{"ConcurrentWrites", testConcurrentWrites},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newStorage(t))
+		})
+	}
+}
+
+func testReadMissing(t *testing.T, s storage.Storage) {
+	items, err := s.Read(context.Background(), []string{"missing"})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Empty(t, items)
+
+	items, err = s.Read(context.Background(), nil)
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	assert.Empty(t, items)
+}
+
+func testWriteRead(t *testing.T, s storage.Storage) {
+	changes := map[string]*storage.Item{
+		"msteams/conversations/a": {Value: json.RawMessage(`{"count":1}`)},
+		"msteams/users/../b":      {Value: json.RawMessage(`["x","y"]`)},
+		"null":                    {},
+	}
+	write(t, s, changes)
+
+	items := read(t, s, "msteams/conversations/a", "msteams/users/../b", "null", "missing")
+	assert.Len(t, items, 3)
+	for key, change := range changes {
+		expected := string(change.Value)
+		if change.Value == nil {
+			expected = "null"
+		}
+		assert.JSONEq(t, expected, string(items[key].Value), fmt.Sprintf("Unexpected value of %q", key))
+		assert.Equal(t, change.ETag, items[key].ETag, fmt.Sprintf("Unexpected ETag of %q", key))
+	}
+}
+
+func testWriteSetsETag(t *testing.T, s storage.Storage) {
+	item := &storage.Item{Value: json.RawMessage(`1`)}
+	write(t, s, map[string]*storage.Item{"key": item})
+	first := item.ETag
+	assert.NotEmpty(t, first, "Expect the ETag of the written item to be set")
+	assert.NotEqual(t, storage.AnyETag, first)
+
+	item.Value = json.RawMessage(`2`)
+	write(t, s, map[string]*storage.Item{"key": item})
+	assert.NotEmpty(t, item.ETag)
+	assert.NotEqual(t, first, item.ETag, "Expect a new ETag for a new revision")
+	assert.Equal(t, item.ETag, read(t, s, "key")["key"].ETag)
+}
+
+func testETagConflict(t *testing.T, s storage.Storage) {
+	write(t, s, map[string]*storage.Item{"key": {Value: json.RawMessage(`1`)}})
+	stale := read(t, s, "key")["key"]
+	current := stale
+	write(t, s, map[string]*storage.Item{"key": {Value: json.RawMessage(`2`), ETag: current.ETag}})
+
+	err := s.Write(context.Background(), map[string]*storage.Item{"key": {Value: json.RawMessage(`3`), ETag: stale.ETag}})
+	assert.True(t, errors.Is(err, storage.ErrETagConflict), fmt.Sprintf("Unexpected error %v", err))
+	assert.JSONEq(t, `2`, string(read(t, s, "key")["key"].Value))
+}
+
+func testConflictWritesNothing(t *testing.T, s storage.Storage) {
+	write(t, s, map[string]*storage.Item{"key": {Value: json.RawMessage(`1`)}})
+
+	err := s.Write(context.Background(), map[string]*storage.Item{
+		"key":   {Value: json.RawMessage(`2`), ETag: "stale"},
+		"other": {Value: json.RawMessage(`2`)},
+	})
+	assert.True(t, errors.Is(err, storage.ErrETagConflict), fmt.Sprintf("Unexpected error %v", err))
+	items := read(t, s, "key", "other")
+	assert.JSONEq(t, `1`, string(items["key"].Value))
+	assert.NotContains(t, items, "other")
+}
+
+func testUnconditionalWrite(t *testing.T, s storage.Storage) {
+	write(t, s, map[string]*storage.Item{"key": {Value: json.RawMessage(`1`)}})
+
+	for i, etag := range []string{"", storage.AnyETag} {
+		value := json.RawMessage(fmt.Sprint(i + 2))
+		write(t, s, map[string]*storage.Item{"key": {Value: value, ETag: etag}})
+		assert.JSONEq(t, string(value), string(read(t, s, "key")["key"].Value))
+	}
+
+	// An ETag is not checked against a missing item
+	write(t, s, map[string]*storage.Item{"new": {Value: json.RawMessage(`1`), ETag: "unknown"}})
+	assert.Contains(t, read(t, s, "new"), "new")
+}
+
+func testDelete(t *testing.T, s storage.Storage) {
+	write(t, s, map[string]*storage.Item{
+		"key":   {Value: json.RawMessage(`1`)},
+		"other": {Value: json.RawMessage(`2`)},
+	})
+
+	err := s.Delete(context.Background(), []string{"key", "missing"})
+	assert.Nil(t, err, fmt.Sprintf("Failed with error %s", err))
+	items := read(t, s, "key", "other")
+	assert.NotContains(t, items, "key")
+	assert.Contains(t, items, "other")
+}
+
+func testValuesNotShared(t *testing.T, s storage.Storage) {
+	value := json.RawMessage(`"abc"`)
+	write(t, s, map[string]*storage.Item{"key": {Value: value}})
+	copy(value, `"xyz"`)
+
+	item := read(t, s, "key")["key"]
+	assert.JSONEq(t, `"abc"`, string(item.Value), "Expect the stored value not to share the written one")
+	copy(item.Value, `"xyz"`)
+	assert.JSONEq(t, `"abc"`, string(read(t, s, "key")["key"].Value), "Expect the stored value not to share the read one")
+}
+
+func testConcurrentWrites(t *testing.T, s storage.Storage) {
+	write(t, s, map[string]*storage.Item{"key": {Value: json.RawMessage(`0`)}})
+	etag := read(t, s, "key")["key"].ETag
+
+	// Only one of the writers based on the same revision may succeed
+	const writers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.Write(context.Background(), map[string]*storage.Item{"key": {Value: json.RawMessage(fmt.Sprint(i)), ETag: etag}})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	written := 0
+	for err := range errs {
+		if err == nil {
+			written++
+			continue
+		}
+		assert.True(t, errors.Is(err, storage.ErrETagConflict), fmt.Sprintf("Unexpected error %v", err))
+	}
+	assert.Equal(t, 1, written, "Expect a single concurrent write to succeed")
+}
+
+func read(t *testing.T, s storage.Storage, keys ...string) map[string]storage.Item {
+	t.Helper()
+	items, err := s.Read(context.Background(), keys)
+	if err != nil {
+		t.Fatalf("Failed to read %v: %s", keys, err)
+	}
+	return items
+}
+
+func write(t *testing.T, s storage.Storage, changes map[string]*storage.Item) {
+	t.Helper()
+	if err := s.Write(context.Background(), changes); err != nil {
+		t.Fatalf("Failed to write: %s", err)
+	}
+}